@@ -0,0 +1,115 @@
+package stravax
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Cursor identifies the next page of a leaderboard to fetch, along with the
+// last entry and EntriesCount which were seen before it so that changes to the
+// leaderboard in the meantime can be detected. A Cursor may be serialized (eg.
+// as JSON) and only resumed by a Client with the same PageSize.
+type Cursor struct {
+	SegmentID    int64     `json:"segment_id"`
+	Gender       Gender    `json:"gender"`
+	Filter       Filter    `json:"filter"`
+	DateRange    DateRange `json:"date_range,omitempty"`
+	Page         int       `json:"page"`
+	PageSize     int       `json:"page_size"`
+	Rank         int64     `json:"rank,omitempty"`
+	EffortID     int64     `json:"effort_id,omitempty"`
+	EntriesCount int64     `json:"entries_count"`
+}
+
+func (c *Client) newCursor(segmentID int64, gender Gender, filter Filter, dateRange DateRange) Cursor {
+	return Cursor{
+		SegmentID: segmentID,
+		Gender:    gender,
+		Filter:    filter,
+		DateRange: dateRange,
+		Page:      1,
+		PageSize:  c.pageSize,
+	}
+}
+
+// advance returns a cursor for resuming leaderboard from page.
+func (cursor Cursor) advance(leaderboard *Leaderboard, page int) *Cursor {
+	cursor.Page = page
+	cursor.EntriesCount = leaderboard.EntriesCount
+	if len(leaderboard.Entries) > 0 {
+		last := leaderboard.Entries[len(leaderboard.Entries)-1]
+		cursor.Rank = last.Rank
+		cursor.EffortID = last.EffortID
+	}
+	return &cursor
+}
+
+// resume removes the entries of leaderboard, the page fetched for cursor, which
+// were already seen before the cursor and records whether it has shifted.
+func (cursor Cursor) resume(leaderboard *Leaderboard) {
+	if leaderboard.EntriesCount != cursor.EntriesCount ||
+		(len(leaderboard.Entries) > 0 && leaderboard.Entries[0].Rank < cursor.Rank) {
+		leaderboard.Shifted = true
+	}
+	if cursor.EffortID == 0 {
+		return
+	}
+	for i, entry := range leaderboard.Entries {
+		if entry.EffortID == cursor.EffortID {
+			leaderboard.Entries = leaderboard.Entries[i+1:]
+			leaderboard.Shifted = true
+			return
+		}
+	}
+}
+
+// ResumeLeaderboard fetches the remainder of the leaderboard described by cursor,
+// typically the Next cursor of a partially fetched Leaderboard. The entries
+// returned are those after the cursor, and are fetched in the same way as by
+// GetLeaderboard.
+func (c *Client) ResumeLeaderboard(cursor *Cursor) (*Leaderboard, error) {
+	return c.ResumeLeaderboardContext(context.Background(), cursor)
+}
+
+// ResumeLeaderboardContext fetches the remainder of the leaderboard described by
+// cursor, typically the Next cursor of a partially fetched Leaderboard. The
+// entries returned are those after the cursor, and are fetched in the same way
+// as by GetLeaderboardContext.
+func (c *Client) ResumeLeaderboardContext(ctx context.Context, cursor *Cursor) (*Leaderboard, error) {
+	leaderboard, _, err := c.getLeaderboard(ctx, *cursor, false)
+	return leaderboard, err
+}
+
+// filterNames maps the query parameter of a Filter to its name.
+var filterNames = map[string]string{
+	"club_id":      "club",
+	"age_group":    "age_group",
+	"weight_class": "weight_class",
+}
+
+// MarshalText encodes the Filter in the form returned by String.
+func (f Filter) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText decodes a Filter previously encoded by MarshalText.
+func (f *Filter) UnmarshalText(text []byte) error {
+	s := string(text)
+	if s == "" {
+		return errors.New("empty filter")
+	}
+	i := strings.Index(s, "=")
+	if i < 0 {
+		*f = Filter{name: s}
+		return nil
+	}
+	name, ok := filterNames[s[:i]]
+	if !ok {
+		return fmt.Errorf("unknown filter parameter %q", s[:i])
+	}
+	*f = Filter{name: name, param: s[:i], value: s[i+1:]}
+	return nil
+}
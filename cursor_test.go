@@ -0,0 +1,129 @@
+package stravax
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResumeLeaderboard(t *testing.T) {
+	var segmentID = int64(2198806)
+	files := []string{"segment-male-overall.1.html", "segment-male-overall.2.html", "segment-male-overall.3.html", "segment-male-overall.4.html", "segment-male-overall.5.html"}
+
+	expected, err := newStubClient(t, files...).GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Running out of stub responses after the third page returns a partial leaderboard.
+	client := newStubClient(t, files[:3]...)
+	partial, err := client.GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err == nil || partial == nil || partial.Next == nil {
+		t.Fatalf("GetLeaderboard(%d, %s, %s): got: (%v, %v), want: partial leaderboard and error",
+			segmentID, Genders.Male, Filters.Overall, partial, err)
+	}
+	last := partial.Entries[len(partial.Entries)-1]
+	want := Cursor{segmentID, Genders.Male, Filters.Overall, DateRanges.AllTime, 4, MAX_PER_PAGE, last.Rank, last.EffortID, 474}
+	if len(partial.Entries) != 3*MAX_PER_PAGE || *partial.Next != want {
+		t.Errorf("GetLeaderboard(%d, %s, %s): got: (%d, %+v), want: (%d, %+v)",
+			segmentID, Genders.Male, Filters.Overall, len(partial.Entries), *partial.Next, 3*MAX_PER_PAGE, want)
+	}
+
+	data, err := json.Marshal(partial.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		t.Fatal(err)
+	}
+	if cursor != want {
+		t.Errorf("json.Unmarshal(%s): got: %+v, want: %+v", data, cursor, want)
+	}
+
+	client = newStubClient(t, files[3:]...)
+	rest, err := client.ResumeLeaderboard(&cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := append(partial.Entries, rest.Entries...)
+	if len(entries) != len(expected.Entries) || rest.Shifted || rest.Next != nil || client.RequestCount != 2 {
+		t.Errorf("ResumeLeaderboard(%+v): got: (%d, %t, %v, %d), want: (%d, %t, %v, %d)",
+			cursor, len(entries), rest.Shifted, rest.Next, client.RequestCount, len(expected.Entries), false, nil, 2)
+	}
+	for i, entry := range entries {
+		if i < len(expected.Entries) && *entry != *expected.Entries[i] {
+			t.Errorf("ResumeLeaderboard(%+v).Entries[%d]: got: %+v, want: %+v", cursor, i, entry, expected.Entries[i])
+		}
+	}
+
+	// Entries already seen before the cursor are skipped if the leaderboard shifted.
+	shifted := cursor
+	shifted.Page = 3
+	client = newStubClient(t, files[2:]...)
+	rest, err = client.ResumeLeaderboard(&shifted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest.Entries) != len(expected.Entries)-3*MAX_PER_PAGE || !rest.Shifted {
+		t.Errorf("ResumeLeaderboard(%+v): got: (%d, %t), want: (%d, %t)",
+			shifted, len(rest.Entries), rest.Shifted, len(expected.Entries)-3*MAX_PER_PAGE, true)
+	}
+
+	// A cursor can't be resumed with a different page size.
+	client = newStubClient(t, files[3:]...)
+	client.pageSize = 20
+	if _, err := client.ResumeLeaderboard(&cursor); err == nil || client.RequestCount != 0 {
+		t.Errorf("ResumeLeaderboard(%+v) with page size %d: got: %v, want: error", cursor, 20, err)
+	}
+}
+
+func TestResumeLeaderboardConcurrent(t *testing.T) {
+	var segmentID = int64(2198806)
+	files := []string{"segment-male-overall.1.html", "segment-male-overall.2.html", "segment-male-overall.3.html", "segment-male-overall.4.html", "segment-male-overall.5.html"}
+
+	client := newStubClient(t)
+	client.httpClient.Transport.(*transport).base = newPageTransport(t, files[:3]...)
+	client.concurrency = 3
+	partial, err := client.GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err == nil || partial == nil || partial.Next == nil {
+		t.Fatalf("GetLeaderboard(%d, %s, %s): got: (%v, %v), want: partial leaderboard and error",
+			segmentID, Genders.Male, Filters.Overall, partial, err)
+	}
+	if len(partial.Entries) != 3*MAX_PER_PAGE || partial.Next.Page != 4 {
+		t.Errorf("GetLeaderboard(%d, %s, %s): got: (%d, %d), want: (%d, %d)",
+			segmentID, Genders.Male, Filters.Overall, len(partial.Entries), partial.Next.Page, 3*MAX_PER_PAGE, 4)
+	}
+
+	client = newStubClient(t)
+	client.httpClient.Transport.(*transport).base = newPageTransport(t, files...)
+	client.concurrency = 3
+	rest, err := client.ResumeLeaderboard(partial.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(partial.Entries) + len(rest.Entries); n != 474 || rest.Shifted || client.RequestCount != 2 {
+		t.Errorf("ResumeLeaderboard(%+v): got: (%d, %t, %d), want: (%d, %t, %d)",
+			*partial.Next, n, rest.Shifted, client.RequestCount, 474, false, 2)
+	}
+}
+
+func TestFilterText(t *testing.T) {
+	filters := []Filter{Filters.Overall, Filters.CurrentYear, Filters.Following,
+		AgeGroups.Age25To34, WeightClasses.Kg115AndOver, Club(12345)}
+	for _, filter := range filters {
+		text, err := filter.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual Filter
+		if err := actual.UnmarshalText(text); err != nil || actual != filter {
+			t.Errorf("UnmarshalText(%s): got: (%#v, %v), want: (%#v, %v)", text, actual, err, filter, nil)
+		}
+	}
+	for _, text := range []string{"", "unknown=1"} {
+		var actual Filter
+		if err := actual.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q): got: %v, want: error", text, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package stravax
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// ErrAuthenticationFailed indicates Strava rejected the credentials of the Client.
+	ErrAuthenticationFailed = errors.New("authentication failed")
+	// ErrSessionExpired indicates Strava no longer considers the Client logged in.
+	ErrSessionExpired = errors.New("session expired")
+	// ErrNotFound indicates the requested segment (or page) does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited indicates Strava refused a request because too many have been made.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrLayoutChanged indicates a page did not have the structure the Client
+	// expects, most likely because Strava has changed its layout.
+	ErrLayoutChanged = errors.New("page layout changed")
+)
+
+// LayoutError indicates that nothing matching Selector could be found on the
+// page at URL. A LayoutError is ErrLayoutChanged.
+type LayoutError struct {
+	URL      string
+	Selector string
+}
+
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("could not find %q on %s", e.Selector, e.URL)
+}
+
+// Is returns whether target is ErrLayoutChanged.
+func (e *LayoutError) Is(target error) bool {
+	return target == ErrLayoutChanged
+}
+
+// ParseError indicates that Text on the page at URL could not be parsed. Row
+// is the 1-based row of the table Text was found in, or 0 if it was found
+// outside of a table.
+type ParseError struct {
+	URL  string
+	Row  int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Row == 0 {
+		return fmt.Sprintf("could not parse %q on %s: %v", e.Text, e.URL, e.Err)
+	}
+	return fmt.Sprintf("could not parse row %d %q on %s: %v", e.Row, e.Text, e.URL, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError indicates that Strava responded to the request for URL with an
+// unexpected StatusCode. A StatusError is ErrNotFound, ErrRateLimited or
+// ErrAuthenticationFailed if its StatusCode indicates so. RetryAfter is how long
+// Strava asked for the client to wait before retrying, if it did.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s for %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+}
+
+// Temporary returns whether the request may succeed if it is retried, ie. if
+// Strava was rate limiting requests or failed with a server error.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Is returns whether target is the sentinel error corresponding to the StatusCode.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrAuthenticationFailed:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// TokenError indicates that the token endpoint at URL refused to refresh a
+// Token, responding with StatusCode, because the refresh token or client
+// credentials were rejected. A TokenError is ErrAuthenticationFailed.
+type TokenError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("token refresh rejected with status %d %s by %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+}
+
+// Unwrap returns ErrAuthenticationFailed.
+func (e *TokenError) Unwrap() error {
+	return ErrAuthenticationFailed
+}
+
+func newLayoutError(doc *goquery.Document, selector string) error {
+	return &LayoutError{URL: documentURL(doc), Selector: selector}
+}
+
+// newParseError returns a ParseError for text in row of doc caused by err,
+// unless err already describes where it occurred.
+func newParseError(doc *goquery.Document, row int, text string, err error) error {
+	switch err.(type) {
+	case *LayoutError, *ParseError:
+		return err
+	}
+	return &ParseError{URL: documentURL(doc), Row: row, Text: text, Err: err}
+}
+
+func documentURL(doc *goquery.Document) string {
+	if doc.Url == nil {
+		return ""
+	}
+	return doc.Url.String()
+}
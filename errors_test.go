@@ -0,0 +1,105 @@
+package stravax
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseErrors(t *testing.T) {
+	var segmentID = int64(2198806)
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "segment-female-yearly.1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The effort ID of the second row can't be parsed.
+	broken := strings.Replace(string(content), "/segment_efforts/40957532893", "/segment_efforts/x", 1)
+	_, err = NewStubClient(broken).GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	var parseErr *ParseError
+	var numErr *strconv.NumError
+	if !errors.As(err, &parseErr) || parseErr.Row != 2 || parseErr.Text == "" ||
+		!strings.HasPrefix(parseErr.URL, BASE_URL) || !errors.As(err, &numErr) {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: %#v, want: *ParseError for row 2",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, err)
+	}
+
+	_, err = NewStubClient("<html></html>").GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	var layoutErr *LayoutError
+	if !errors.Is(err, ErrLayoutChanged) || !errors.As(err, &layoutErr) || layoutErr.Selector != ".standing strong" {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: %#v, want: *LayoutError for %q",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, err, ".standing strong")
+	}
+
+	_, _, err = NewStubClient("<html></html>").GetRecordsAndSegment(segmentID)
+	if !errors.Is(err, ErrLayoutChanged) {
+		t.Errorf("GetRecordsAndSegment(%d): got: %v, want: %v", segmentID, err, ErrLayoutChanged)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		session  string
+		expected error
+	}{
+		{"no csrf", `<html></html>`, ``, ErrLayoutChanged},
+		{"bad credentials",
+			`<html><head><meta name="csrf-param" content="authenticity_token" /><meta name="csrf-token" content="token" /></head></html>`,
+			`<html><head><title>Log In | Strava</title></head></html>`, ErrAuthenticationFailed},
+	}
+	for _, tt := range tests {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, tt.login)
+		})
+		mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, tt.session)
+		})
+		server := httptest.NewServer(mux)
+		_, err := New(context.Background(), "email", "password", WithBaseURL(server.URL), WithRateLimit(0))
+		server.Close()
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("New(%s): got: %v, want: %v", tt.name, err, tt.expected)
+		}
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	var segmentID = int64(2198806)
+	tests := []struct {
+		handler  http.HandlerFunc
+		expected error
+	}{
+		{func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }, ErrNotFound},
+		{func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}, ErrRateLimited},
+		{func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}, ErrSessionExpired},
+	}
+	for _, tt := range tests {
+		server := newLoginServer(func(*http.Request) {}, tt.handler)
+		client, err := New(context.Background(), "email", "password",
+			WithBaseURL(server.URL), WithRateLimit(0), WithRetryPolicy(RetryPolicy{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+		server.Close()
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: %v, want: %v",
+				segmentID, Genders.Female, Filters.CurrentYear, 1, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package stravax
+
+import (
+	"golang.org/x/net/context"
+)
+
+// LeaderboardIterator steps through the entries of a leaderboard in rank order,
+// only fetching the next page once every entry of the previous page has been
+// consumed. Stopping iteration early avoids fetching the remaining pages.
+//
+//	it := client.IterateLeaderboard(segmentID, stravax.Genders.Male, stravax.Filters.Overall)
+//	for it.Next() {
+//		entry := it.Entry()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// A LeaderboardIterator is not safe for concurrent use.
+type LeaderboardIterator struct {
+	client  *Client
+	ctx     context.Context
+	url     string
+	gender  Gender
+	page    int
+	final   bool
+	current *Leaderboard
+	index   int
+	shifted bool
+	err     error
+}
+
+// IterateLeaderboard returns an iterator over the leaderboard of segmentID for
+// the specified gender and filter. The leaderboard may optionally be restricted
+// to a dateRange.
+func (c *Client) IterateLeaderboard(segmentID int64, gender Gender, filter Filter, dateRange ...DateRange) *LeaderboardIterator {
+	return c.IterateLeaderboardContext(context.Background(), segmentID, gender, filter, dateRange...)
+}
+
+// IterateLeaderboardContext returns an iterator over the leaderboard of segmentID
+// for the specified gender and filter which fetches pages using ctx. The
+// leaderboard may optionally be restricted to a dateRange.
+func (c *Client) IterateLeaderboardContext(ctx context.Context, segmentID int64, gender Gender, filter Filter, dateRange ...DateRange) *LeaderboardIterator {
+	return &LeaderboardIterator{
+		client: c,
+		ctx:    ctx,
+		url:    c.getLeaderboardURL(segmentID, gender, filter, optionalDateRange(dateRange)),
+		gender: gender,
+		index:  -1,
+	}
+}
+
+// Next advances the iterator to the next entry, fetching the next page of the
+// leaderboard if necessary. It returns false once there are no more entries or
+// an error occurs, after which Err should be checked.
+func (it *LeaderboardIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	for it.current == nil || it.index >= len(it.current.Entries) {
+		if it.final {
+			return false
+		}
+		next, _, final, err :=
+			it.client.getLeaderboardPageForURL(it.ctx, it.url, it.gender, it.page+1, false)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if it.current != nil && shifted(it.current, next) {
+			it.shifted = true
+		}
+		it.page++
+		it.final = final
+		it.current = next
+		it.index = 0
+	}
+	return true
+}
+
+// Entry returns the current entry of the leaderboard.
+func (it *LeaderboardIterator) Entry() *LeaderboardEntry {
+	if it.current == nil || it.index >= len(it.current.Entries) {
+		return nil
+	}
+	return it.current.Entries[it.index]
+}
+
+// Page returns the page of the leaderboard the current entry was fetched from.
+func (it *LeaderboardIterator) Page() int {
+	return it.page
+}
+
+// EntriesCount returns the number of entries in the leaderboard according to
+// the page the current entry was fetched from. The count may change from one
+// page to the next if activities are uploaded or deleted during iteration.
+func (it *LeaderboardIterator) EntriesCount() int64 {
+	if it.current == nil {
+		return 0
+	}
+	return it.current.EntriesCount
+}
+
+// Viewer returns the Standing of the logged in athlete according to the page
+// the current entry was fetched from, or nil if they do not appear on the leaderboard.
+func (it *LeaderboardIterator) Viewer() *Standing {
+	if it.current == nil {
+		return nil
+	}
+	return it.current.Viewer
+}
+
+// Shifted returns whether the leaderboard has been observed to change between
+// any of the pages fetched so far.
+func (it *LeaderboardIterator) Shifted() bool {
+	return it.shifted
+}
+
+// Err returns the error which stopped iteration, if any.
+func (it *LeaderboardIterator) Err() error {
+	return it.err
+}
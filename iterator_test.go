@@ -0,0 +1,80 @@
+package stravax
+
+import (
+	"testing"
+)
+
+func TestIterateLeaderboard(t *testing.T) {
+	var segmentID = int64(2198806)
+	files := []string{"segment-male-overall.1.html", "segment-male-overall.2.html", "segment-male-overall.3.html", "segment-male-overall.4.html", "segment-male-overall.5.html"}
+
+	expected, err := newStubClient(t, files...).GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newStubClient(t, files...)
+	it := client.IterateLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	i := 0
+	for ; it.Next(); i++ {
+		if i < len(expected.Entries) && *it.Entry() != *expected.Entries[i] {
+			t.Errorf("IterateLeaderboard(%d, %s, %s).Entry() %d: got: %+v, want: %+v",
+				segmentID, Genders.Male, Filters.Overall, i, it.Entry(), expected.Entries[i])
+		}
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if i != len(expected.Entries) ||
+		it.EntriesCount() != expected.EntriesCount ||
+		it.Page() != 5 ||
+		it.Shifted() ||
+		client.RequestCount != 5 {
+		t.Errorf("IterateLeaderboard(%d, %s, %s): got: (%d, %d, %d, %t, %d), want: (%d, %d, %d, %t, %d)",
+			segmentID, Genders.Male, Filters.Overall, i, it.EntriesCount(), it.Page(), it.Shifted(),
+			client.RequestCount, len(expected.Entries), expected.EntriesCount, 5, false, 5)
+	}
+}
+
+func TestIterateLeaderboardStop(t *testing.T) {
+	var segmentID = int64(2198806)
+	client := newStubClient(t, "segment-male-overall.1.html", "segment-male-overall.2.html")
+	it := client.IterateLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	for i := 0; i < MAX_PER_PAGE+1; i++ {
+		if !it.Next() {
+			t.Fatalf("IterateLeaderboard(%d, %s, %s).Next() %d: got: %t, want: %t",
+				segmentID, Genders.Male, Filters.Overall, i, false, true)
+		}
+	}
+	// Stopping early doesn't fetch any further pages.
+	if it.Page() != 2 || client.RequestCount != 2 {
+		t.Errorf("IterateLeaderboard(%d, %s, %s): got: (%d, %d), want: (%d, %d)",
+			segmentID, Genders.Male, Filters.Overall, it.Page(), client.RequestCount, 2, 2)
+	}
+
+	// Running out of stub responses surfaces the error once the entries are consumed.
+	for it.Next() {
+	}
+	if it.Err() == nil || it.Entry() != nil {
+		t.Errorf("IterateLeaderboard(%d, %s, %s).Err(): got: %v, want: error",
+			segmentID, Genders.Male, Filters.Overall, it.Err())
+	}
+}
+
+func TestIterateLeaderboardShifted(t *testing.T) {
+	var segmentID = int64(2198806)
+	client := newStubClient(t, "segment-male-overall.1.html", "segment-female-overall.2.html")
+	it := client.IterateLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	var counts []int64
+	for it.Next() {
+		if len(counts) == 0 || counts[len(counts)-1] != it.EntriesCount() {
+			counts = append(counts, it.EntriesCount())
+		}
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if !it.Shifted() || len(counts) != 2 || counts[0] != 474 || counts[1] != 120 {
+		t.Errorf("IterateLeaderboard(%d, %s, %s): got: (%t, %v), want: (%t, %v)",
+			segmentID, Genders.Male, Filters.Overall, it.Shifted(), counts, true, []int64{474, 120})
+	}
+}
@@ -0,0 +1,141 @@
+package stravax
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Limiter limits the rate at which a Client makes requests to Strava. A single
+// Limiter is shared by every request a Client makes to both the API and the
+// frontend, and may be shared between Clients. Implementations must be safe for
+// concurrent use.
+type Limiter interface {
+	// Wait blocks until another request may be made, or returns an error if
+	// ctx is done first.
+	Wait(ctx context.Context) error
+}
+
+// Budget is a maximum number of Requests which may be made in each Period.
+// Periods are aligned to the clock in UTC, eg. a Period of 15 minutes resets on
+// the quarter hour and a Period of 24 hours resets at midnight.
+type Budget struct {
+	Requests int
+	Period   time.Duration
+}
+
+// APIBudgets are the default limits Strava places on read requests to its API.
+var APIBudgets = []Budget{{100, 15 * time.Minute}, {1000, 24 * time.Hour}}
+
+// RateLimiter is a token bucket Limiter which additionally enforces Budgets.
+type RateLimiter struct {
+	mu      sync.Mutex
+	clock   clock
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	budgets []Budget
+	windows []time.Time
+	counts  []int
+}
+
+// NewLimiter returns a RateLimiter which allows rate requests per second on
+// average with bursts of up to burst requests, and at most the number of requests
+// allowed by each of budgets. A rate of 0 only enforces the budgets.
+func NewLimiter(rate float64, burst int, budgets ...Budget) *RateLimiter {
+	return newLimiter(realClock{}, rate, burst, budgets...)
+}
+
+func newLimiter(c clock, rate float64, burst int, budgets ...Budget) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		clock:   c,
+		rate:    rate,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    c.Now(),
+		budgets: budgets,
+		windows: make([]time.Time, len(budgets)),
+		counts:  make([]int, len(budgets)),
+	}
+}
+
+// Wait blocks until another request may be made, or returns an error if ctx is
+// done first.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d := l.reserve()
+		if d <= 0 {
+			return nil
+		}
+		select {
+		case <-l.clock.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token and counts a request against each budget if a request
+// may be made now, otherwise it returns how long to wait before trying again.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	var wait time.Duration
+	for i, b := range l.budgets {
+		window := now.UTC().Truncate(b.Period)
+		if !window.Equal(l.windows[i]) {
+			l.windows[i], l.counts[i] = window, 0
+		}
+		if l.counts[i] >= b.Requests {
+			if d := window.Add(b.Period).Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens < 1 {
+			d := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+			if d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if l.rate > 0 {
+		l.tokens--
+	}
+	for i := range l.counts {
+		l.counts[i]++
+	}
+	return 0
+}
+
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
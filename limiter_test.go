@@ -0,0 +1,96 @@
+package stravax
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeClock advances its time by d whenever After(d) is called instead of
+// actually waiting.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Date(2018, time.June, 1, 12, 10, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		budgets  []Budget
+		requests int
+		expected time.Duration
+	}{
+		{"unlimited", 0, 1, nil, 100, 0},
+		{"10qps", 10, 1, nil, 11, time.Second},
+		{"10qps burst", 10, 5, nil, 15, time.Second},
+		{"budget", 0, 1, []Budget{{3, 15 * time.Minute}}, 4, 5 * time.Minute},
+		{"budgets", 10, 1, []Budget{{5, 15 * time.Minute}, {6, 24 * time.Hour}}, 7, 11*time.Hour + 50*time.Minute},
+	}
+	for _, tt := range tests {
+		clock := &fakeClock{now: start}
+		l := newLimiter(clock, tt.rate, tt.burst, tt.budgets...)
+		for i := 0; i < tt.requests; i++ {
+			if err := l.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if actual := clock.Now().Sub(start); actual != tt.expected {
+			t.Errorf("%s: %d requests: got: %v, want: %v", tt.name, tt.requests, actual, tt.expected)
+		}
+	}
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	l := NewLimiter(0, 1, Budget{1, time.Hour})
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait: got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	start := time.Date(2018, time.June, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	l := newLimiter(clock, 0, 1, Budget{50, time.Hour})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := l.Wait(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if actual := clock.Now(); !actual.Equal(start) {
+		t.Errorf("50 concurrent requests: got: %v, want: %v", actual.Sub(start), time.Duration(0))
+	}
+}
@@ -0,0 +1,278 @@
+package stravax
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+
+	"github.com/scheibo/strava"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/publicsuffix"
+)
+
+// BASE_URL is the URL of the Strava frontend.
+const BASE_URL = "https://www.strava.com"
+
+// TIMEOUT is the default timeout for each request made to Strava.
+const TIMEOUT = 10 * time.Second
+
+type options struct {
+	httpClient  *http.Client
+	transport   http.RoundTripper
+	baseURL     string
+	userAgent   string
+	rateLimit   int
+	limiter     Limiter
+	pageSize    int
+	concurrency int
+	refetches   int
+	retryPolicy RetryPolicy
+	credentials Credentials
+	loginHook   func(error)
+	session     *Session
+	timeout     time.Duration
+	accessToken string
+	tokenSource TokenSource
+}
+
+// Option configures a Client created by New.
+type Option func(*options)
+
+// WithHTTPClient makes the Client issue requests through httpClient instead of
+// a client with a cookie jar, TIMEOUT and default transport. httpClient is
+// copied, and a cookie jar is added to the copy if it does not have one.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithTransport makes the Client issue requests through transport instead of
+// http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithBaseURL makes the Client issue requests against baseURL instead of BASE_URL.
+// The Strava API is expected to be served from baseURL + "/api/v3".
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) {
+		o.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithUserAgent makes the Client identify itself with userAgent instead of USER_AGENT.
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithRateLimit makes the Client issue at most qps requests per second instead
+// of QPS_LIMIT. A qps of 0 disables rate limiting.
+func WithRateLimit(qps int) Option {
+	return func(o *options) {
+		o.rateLimit = qps
+	}
+}
+
+// WithLimiter makes the Client wait on limiter before every request instead of
+// limiting requests to QPS_LIMIT per second. limiter takes precedence over
+// WithRateLimit, and may be shared between Clients.
+func WithLimiter(limiter Limiter) Option {
+	return func(o *options) {
+		o.limiter = limiter
+	}
+}
+
+// WithPageSize makes the Client request pageSize leaderboard entries per page
+// instead of MAX_PER_PAGE.
+func WithPageSize(pageSize int) Option {
+	return func(o *options) {
+		o.pageSize = pageSize
+	}
+}
+
+// WithConcurrency makes the Client fetch up to n pages at a time when retrieving
+// a complete leaderboard instead of fetching each page in turn. The number of
+// pages is determined from the first page, and every request remains subject to
+// the Client's rate limit.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithRefetches makes the Client re-fetch up to n pages of a leaderboard which
+// appears to have shifted while it was being fetched, in order to reconcile the
+// entries either side of each affected page boundary. See Leaderboard.Consistent.
+func WithRefetches(n int) Option {
+	return func(o *options) {
+		o.refetches = n
+	}
+}
+
+// WithRetryPolicy makes the Client retry requests according to policy instead
+// of DefaultRetryPolicy. The zero RetryPolicy disables retries.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithCredentials makes the Client log in with the email and password returned
+// by credentials when its session expires, instead of those passed to New.
+func WithCredentials(credentials Credentials) Option {
+	return func(o *options) {
+		o.credentials = credentials
+	}
+}
+
+// WithLoginHook makes the Client call hook each time it logs in again after
+// its session expired, with the error logging in, if any.
+func WithLoginHook(hook func(err error)) Option {
+	return func(o *options) {
+		o.loginHook = hook
+	}
+}
+
+// WithSession makes New restore session instead of logging in. The session is
+// not validated until the Client makes a request, and if it has expired by then
+// the Client logs in again as it would once any other session expires.
+func WithSession(session *Session) Option {
+	return func(o *options) {
+		o.session = session
+	}
+}
+
+// WithTimeout makes the Client time out each request after timeout instead of TIMEOUT.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithAccessToken makes the Client use accessToken to authenticate requests
+// made against the Strava API. GetSegment requires an access token (or a
+// TokenSource). Strava access tokens expire after six hours, see WithTokenSource.
+func WithAccessToken(accessToken string) Option {
+	return func(o *options) {
+		o.accessToken = accessToken
+	}
+}
+
+// WithTokenSource makes the Client use the tokens supplied by tokenSource to
+// authenticate requests made against the Strava API, eg. a RefreshTokenSource
+// to keep using the API after the initial access token expires. tokenSource
+// takes precedence over WithAccessToken.
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(o *options) {
+		o.tokenSource = tokenSource
+	}
+}
+
+// New returns a Client configured by opts and authenticated with email and
+// password for querying Strava, logging in using ctx.
+// If Strava later expires the session, the Client logs in again with the same
+// email and password (see WithCredentials) and retries the request once. If
+// Strava rejects the credentials, the Client stops logging in and fails each
+// request which finds its session expired with ErrAuthenticationFailed.
+func New(ctx context.Context, email, password string, opts ...Option) (*Client, error) {
+	o := &options{
+		baseURL:     BASE_URL,
+		userAgent:   USER_AGENT,
+		rateLimit:   QPS_LIMIT,
+		pageSize:    MAX_PER_PAGE,
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.pageSize < 1 || o.pageSize > MAX_PER_PAGE {
+		return nil, fmt.Errorf("page size %d must be between 1 and %d", o.pageSize, MAX_PER_PAGE)
+	}
+	if o.rateLimit < 0 {
+		return nil, fmt.Errorf("rate limit %d must not be negative", o.rateLimit)
+	}
+	if o.concurrency < 0 {
+		return nil, fmt.Errorf("concurrency %d must not be negative", o.concurrency)
+	}
+	if o.refetches < 0 {
+		return nil, fmt.Errorf("refetches %d must not be negative", o.refetches)
+	}
+	if p := o.retryPolicy; p.Retries < 0 || p.Budget < 0 || p.MinBackoff < 0 || p.MaxBackoff < p.MinBackoff {
+		return nil, fmt.Errorf("invalid retry policy %+v", p)
+	}
+
+	httpClient := &http.Client{Timeout: TIMEOUT}
+	if o.httpClient != nil {
+		hc := *o.httpClient
+		httpClient = &hc
+	}
+	if o.timeout != 0 {
+		httpClient.Timeout = o.timeout
+	}
+	if httpClient.Jar == nil {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Jar = jar
+	}
+	jar := newSessionJar(httpClient.Jar)
+	httpClient.Jar = jar
+	base := o.transport
+	if base == nil {
+		base = httpClient.Transport
+	}
+	st := &stats{}
+	httpClient.Transport = &transport{userAgent: o.userAgent, base: base, stats: st}
+
+	c := &Client{
+		stats:       st,
+		limiter:     o.limiter,
+		httpClient:  httpClient,
+		jar:         jar,
+		baseURL:     o.baseURL,
+		pageSize:    o.pageSize,
+		concurrency: o.concurrency,
+		refetches:   o.refetches,
+		retryPolicy: o.retryPolicy,
+		logins:      &logins{credentials: o.credentials, hook: o.loginHook},
+	}
+	if c.logins.credentials == nil {
+		c.logins.credentials = func(context.Context) (string, string, error) {
+			return email, password, nil
+		}
+	}
+	if c.limiter == nil && o.rateLimit > 0 {
+		c.limiter = NewLimiter(float64(o.rateLimit), 1)
+	}
+	c.tokenSource = o.tokenSource
+	if c.tokenSource == nil && o.accessToken != "" {
+		c.tokenSource = staticTokenSource{&Token{AccessToken: o.accessToken}}
+	}
+	if c.tokenSource != nil {
+		cfg := strava.NewConfiguration()
+		cfg.BasePath = o.baseURL + "/api/v3"
+		cfg.UserAgent = o.userAgent
+		cfg.HTTPClient = httpClient
+		c.stravaClient = strava.NewAPIClient(cfg)
+	}
+
+	if o.session != nil {
+		if o.session.BaseURL != o.baseURL {
+			return nil, fmt.Errorf("session for %s can not be used with %s", o.session.BaseURL, o.baseURL)
+		}
+		if err := c.restore(o.session); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return c.login(ctx, email, password)
+}
@@ -0,0 +1,123 @@
+package stravax
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// newStubServer returns a server which accepts any login and serves file for
+// every segment page. Each request to the server is passed to check.
+func newStubServer(t *testing.T, file string, check func(*http.Request)) *httptest.Server {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newLoginServer(check, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	})
+}
+
+// newLoginServer returns a server which accepts any login and handles every
+// request for a segment page made with the resulting session with segments.
+// Each request to the server is passed to check.
+func newLoginServer(check func(*http.Request), segments http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		fmt.Fprint(w, `<html><head>`+
+			`<meta name="csrf-param" content="authenticity_token" />`+
+			`<meta name="csrf-token" content="token" />`+
+			`</head></html>`)
+	})
+	mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		if r.Method != "POST" || r.FormValue("authenticity_token") != "token" {
+			http.Error(w, "bad session request", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "_strava4_session", Value: "session"})
+		fmt.Fprint(w, `<html><head><title>Dashboard | Strava</title></head></html>`)
+	})
+	mux.HandleFunc("/segments/", func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		if _, err := r.Cookie("_strava4_session"); err != nil {
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+		segments(w, r)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestNew(t *testing.T) {
+	var segmentID = int64(2198806)
+	var userAgents []string
+	var pageSizes []string
+	server := newStubServer(t, "segment-female-yearly.1.html", func(r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		if r.URL.Path != "/login" && r.URL.Path != "/session" {
+			pageSizes = append(pageSizes, r.URL.Query().Get("per_page"))
+		}
+	})
+	defer server.Close()
+
+	client, err := New(context.Background(), "email", "password",
+		WithBaseURL(server.URL+"/"),
+		WithUserAgent("test/1.0"),
+		WithPageSize(20),
+		WithRateLimit(0),
+		WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderboard, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard.Entries) != 4 || client.RequestCount != 1 {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: (%d, %d), want: (%d, %d)",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, len(leaderboard.Entries), client.RequestCount, 4, 1)
+	}
+	for _, ua := range userAgents {
+		if ua != "test/1.0" {
+			t.Errorf("User-Agent: got: %q, want: %q", ua, "test/1.0")
+		}
+	}
+	if len(pageSizes) != 1 || pageSizes[0] != "20" {
+		t.Errorf("per_page: got: %v, want: %v", pageSizes, []string{"20"})
+	}
+	// Logging in (GET /login, POST /session) is included in the stats.
+	if stats := client.Stats(); stats.Frontend.Requests != 3 ||
+		stats.Frontend.StatusCodes[200] != 3 ||
+		stats.Frontend.BytesSent == 0 ||
+		stats.API.Requests != 0 {
+		t.Errorf("Stats(): got: %+v, want: 3 successful frontend requests", stats)
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"WithPageSize(0)", WithPageSize(0)},
+		{"WithPageSize(MAX_PER_PAGE+1)", WithPageSize(MAX_PER_PAGE + 1)},
+		{"WithRateLimit(-1)", WithRateLimit(-1)},
+		{"WithConcurrency(-1)", WithConcurrency(-1)},
+		{"WithRefetches(-1)", WithRefetches(-1)},
+		{"WithRetryPolicy(Retries: -1)", WithRetryPolicy(RetryPolicy{Retries: -1})},
+		{"WithRetryPolicy(MaxBackoff < MinBackoff)", WithRetryPolicy(RetryPolicy{MinBackoff: time.Second})},
+	}
+	for _, tt := range tests {
+		if _, err := New(context.Background(), "email", "password", tt.opt); err == nil {
+			t.Errorf("New(%s): got: %v, want: error", tt.name, err)
+		}
+	}
+}
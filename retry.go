@@ -0,0 +1,112 @@
+package stravax
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy controls how a Client retries requests which Strava fails to
+// serve because of a transient problem, ie. those which result in a 429 or 5xx
+// StatusError.
+type RetryPolicy struct {
+	// Retries is the maximum number of times each request is retried.
+	Retries int
+	// MinBackoff is the wait before the first retry, which doubles for each
+	// subsequent retry of the same request up to MaxBackoff. Each wait is
+	// jittered by up to half its length. A Retry-After from Strava is honoured
+	// in place of the backoff unless it exceeds MaxBackoff, in which case the
+	// request is not retried.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Budget is the maximum number of retries across every request made by the
+	// Client, or 0 for no limit.
+	Budget int
+}
+
+// DefaultRetryPolicy is the RetryPolicy of a Client created by New.
+var DefaultRetryPolicy = RetryPolicy{Retries: 3, MinBackoff: time.Second, MaxBackoff: 30 * time.Second}
+
+// retry calls attempt until it succeeds or returns an error which should not be
+// retried according to the RetryPolicy of the Client, waiting before each
+// attempt until the Client may make another request.
+func (c *Client) retry(ctx context.Context, attempt func() error) error {
+	for i := 0; ; i++ {
+		if err := c.request(ctx); err != nil {
+			return err
+		}
+		err := attempt()
+		wait, ok := c.backoff(err, i)
+		if !ok {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying a request whose previous
+// attempt returned err, or false if it should not be retried.
+func (c *Client) backoff(err error, attempt int) (time.Duration, bool) {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || !statusErr.Temporary() || attempt >= c.retryPolicy.Retries {
+		return 0, false
+	}
+	p := c.retryPolicy
+	if statusErr.RetryAfter > p.MaxBackoff {
+		return 0, false
+	}
+	if p.Budget > 0 && atomic.AddInt64(&c.retries, 1) > int64(p.Budget) {
+		return 0, false
+	}
+	if statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, true
+	}
+
+	d := p.MinBackoff << uint(attempt)
+	if d > p.MaxBackoff || d < p.MinBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// newStatusError returns a StatusError for resp, the response to the request for url.
+func newStatusError(url string, resp *http.Response) *StatusError {
+	return &StatusError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter returns the duration indicated by a Retry-After header, which
+// is either a number of seconds or a date, or 0 if it can not be parsed.
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	t, err := http.ParseTime(s)
+	if err != nil || !t.After(now) {
+		return 0
+	}
+	return t.Sub(now)
+}
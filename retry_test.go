@@ -0,0 +1,95 @@
+package stravax
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRetry(t *testing.T) {
+	var segmentID = int64(2198806)
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "segment-female-yearly.1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := RetryPolicy{Retries: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	tests := []struct {
+		name                 string
+		statuses             []int
+		retryAfter           string
+		policy               RetryPolicy
+		expectedRequestCount int64
+		expectedStatus       int
+	}{
+		{"recovers", []int{503, 500}, "", policy, 3, 0},
+		{"rate limited", []int{429}, "0", policy, 2, 0},
+		{"exhausted", []int{502, 502, 502, 502}, "", policy, 4, 502},
+		{"retry after too long", []int{429}, "60", policy, 1, 429},
+		{"not found", []int{404}, "", policy, 1, 404},
+		{"budget", []int{500, 500}, "", RetryPolicy{3, time.Millisecond, time.Millisecond, 1}, 2, 500},
+		{"disabled", []int{500}, "", RetryPolicy{}, 1, 500},
+	}
+	for _, tt := range tests {
+		var n int32
+		server := newLoginServer(func(*http.Request) {}, func(w http.ResponseWriter, r *http.Request) {
+			i := int(atomic.AddInt32(&n, 1)) - 1
+			if i < len(tt.statuses) {
+				w.Header().Set("Retry-After", tt.retryAfter)
+				http.Error(w, http.StatusText(tt.statuses[i]), tt.statuses[i])
+				return
+			}
+			w.Write(content)
+		})
+		client, err := New(context.Background(), "email", "password",
+			WithBaseURL(server.URL), WithRateLimit(0), WithRetryPolicy(tt.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+		server.Close()
+
+		status := 0
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			status = statusErr.StatusCode
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if client.RequestCount != tt.expectedRequestCount || status != tt.expectedStatus {
+			t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) %s: got: (%d, %d), want: (%d, %d)",
+				segmentID, Genders.Female, Filters.CurrentYear, 1, tt.name, client.RequestCount, status,
+				tt.expectedRequestCount, tt.expectedStatus)
+		}
+		if tt.retryAfter == "60" && (statusErr == nil || statusErr.RetryAfter != time.Minute) {
+			t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) %s: got: %v, want: RetryAfter %s",
+				segmentID, Genders.Female, Filters.CurrentYear, 1, tt.name, err, time.Minute)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"Tue, 12 Jun 2018 12:01:30 GMT", 90 * time.Second},
+		{"Tue, 12 Jun 2018 11:59:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		actual := parseRetryAfter(tt.header, now)
+		if actual != tt.expected {
+			t.Errorf("parseRetryAfter(%q): got: %s, want: %s", tt.header, actual, tt.expected)
+		}
+	}
+}
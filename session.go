@@ -0,0 +1,267 @@
+package stravax
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"golang.org/x/net/context"
+)
+
+// Credentials returns the email and password a Client logs in to Strava with
+// when its session has expired.
+type Credentials func(ctx context.Context) (email, password string, err error)
+
+// logins tracks the logins of a Client so that when several concurrent
+// requests find its session has expired, it only logs in again once.
+type logins struct {
+	mu          sync.Mutex
+	generation  int
+	credentials Credentials
+	hook        func(error)
+	// csrfParam and csrfToken are recorded by login, which is only called
+	// while mu is held or before the Client is in use.
+	csrfParam string
+	csrfToken string
+	// rejected is the error from logging in again once Strava has rejected
+	// the credentials, after which the Client no longer tries to log in.
+	rejected error
+}
+
+func (s *logins) current() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation
+}
+
+// relogin logs in to Strava again, unless the Client has already done so since
+// the session generation had expired. Once Strava has rejected the credentials
+// the same error is returned without logging in again, as repeatedly posting
+// rejected credentials would only fail again and look suspicious to Strava.
+func (c *Client) relogin(ctx context.Context, generation int) error {
+	s := c.logins
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rejected != nil {
+		return s.rejected
+	}
+	if s.generation != generation {
+		return nil
+	}
+	email, password, err := s.credentials(ctx)
+	if err == nil {
+		_, err = c.login(ctx, email, password)
+	}
+	if s.hook != nil {
+		s.hook(err)
+	}
+	if errors.Is(err, ErrAuthenticationFailed) {
+		s.rejected = err
+	}
+	if err != nil {
+		return err
+	}
+	s.generation++
+	return nil
+}
+
+// loginPath returns the path of the login page of the Strava frontend, which
+// may be below a path prefix of the base URL of the Client.
+func (c *Client) loginPath() string {
+	u, err := url.Parse(c.baseURL + "/login")
+	if err != nil {
+		return "/login"
+	}
+	return u.Path
+}
+
+// loggedOut returns whether doc is the page Strava serves to logged out visitors
+// in place of the page which was requested.
+func loggedOut(doc *goquery.Document) bool {
+	return strings.HasPrefix(doc.Find("title").Text(), "Log In") ||
+		doc.Find("form#login_form").Length() > 0
+}
+
+// sessionJar wraps the cookie jar of a Client to record the cookies it is given
+// along with their attributes, as the cookies returned by its Cookies method
+// only have a Name and Value but a Session must restore them as they were set.
+type sessionJar struct {
+	http.CookieJar
+	mu      sync.Mutex
+	cookies map[string]savedCookie
+}
+
+// savedCookie is a cookie recorded by a sessionJar, along with the host it was
+// set for if it is a host-only cookie.
+type savedCookie struct {
+	host   string
+	cookie *http.Cookie
+}
+
+func newSessionJar(jar http.CookieJar) *sessionJar {
+	return &sessionJar{CookieJar: jar, cookies: make(map[string]savedCookie)}
+}
+
+// SetCookies records cookies before passing them on to the wrapped jar.
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		saved := savedCookie{cookie: &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			SameSite: c.SameSite,
+		}}
+		if saved.cookie.Path == "" || saved.cookie.Path[0] != '/' {
+			saved.cookie.Path = defaultPath(u.Path)
+		}
+		if saved.cookie.Domain == "" {
+			saved.host = u.Host
+		}
+		key := strings.Join([]string{c.Name, saved.cookie.Domain, saved.host, saved.cookie.Path}, ";")
+		// Max-Age is relative to when the cookie was set, so is converted to
+		// the time the cookie expires for the cookie to be restored later.
+		switch {
+		case c.MaxAge < 0 || (!c.Expires.IsZero() && !c.Expires.After(now)):
+			delete(j.cookies, key)
+			continue
+		case c.MaxAge > 0:
+			saved.cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		j.cookies[key] = saved
+	}
+	j.CookieJar.SetCookies(u, cookies)
+}
+
+// saved returns the cookies which the wrapped jar would send to u as they
+// were recorded when they were set.
+func (j *sessionJar) saved(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var cookies []*http.Cookie
+	for _, c := range j.CookieJar.Cookies(u) {
+		cookie := c
+		for _, saved := range j.cookies {
+			if saved.cookie.Name == c.Name && saved.cookie.Value == c.Value &&
+				(saved.host == "" || saved.host == u.Host) {
+				cookie = saved.cookie
+				break
+			}
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+// defaultPath returns the path a cookie set for a URL with path applies to if
+// it does not specify one, as described in RFC 6265 section 5.1.4.
+func defaultPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// Session is the state of a Client logged in to Strava, which may be saved and
+// later restored with WithSession to avoid logging in again each time a Client
+// is created. Cookies retain the attributes (eg. Domain, Path and Expires) they
+// were set with. A Session grants access to the Strava account, so should be
+// stored as carefully as the account's password.
+type Session struct {
+	BaseURL   string         `json:"base_url"`
+	Cookies   []*http.Cookie `json:"cookies"`
+	CSRFParam string         `json:"csrf_param"`
+	CSRFToken string         `json:"csrf_token"`
+	SavedAt   time.Time      `json:"saved_at"`
+}
+
+// Session returns the session the Client is currently logged in with. The
+// session changes when the Client logs in again (see WithLoginHook).
+func (c *Client) Session() (*Session, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	c.logins.mu.Lock()
+	defer c.logins.mu.Unlock()
+	return &Session{
+		BaseURL:   c.baseURL,
+		Cookies:   c.jar.saved(u),
+		CSRFParam: c.logins.csrfParam,
+		CSRFToken: c.logins.csrfToken,
+		SavedAt:   time.Now(),
+	}, nil
+}
+
+// restore adds the cookies of s to the cookie jar of the Client.
+func (c *Client) restore(s *Session) error {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return err
+	}
+	c.jar.SetCookies(u, s.Cookies)
+	c.logins.csrfParam, c.logins.csrfToken = s.CSRFParam, s.CSRFToken
+	return nil
+}
+
+// Save writes s to w as JSON.
+func (s *Session) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// SaveFile writes s to the file at path, which is only readable and writable by
+// its owner.
+func (s *Session) SaveFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// The file may have already existed with more permissive permissions.
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := s.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadSession reads a Session previously written by Session.Save from r.
+func LoadSession(r io.Reader) (*Session, error) {
+	var s Session
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadSessionFile reads a Session previously written by Session.SaveFile from
+// the file at path.
+func LoadSessionFile(path string) (*Session, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadSession(f)
+}
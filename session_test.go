@@ -0,0 +1,327 @@
+package stravax
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// sessionExpires is when the sessions of a sessionServer expire.
+var sessionExpires = time.Date(2038, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// sessionServer is a Strava frontend which only accepts the password
+// "password" and expires each session after it has served a segment page if
+// expire is true.
+type sessionServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	sessions int
+	valid    string
+	logins   int
+	expire   bool
+}
+
+func newSessionServer(t *testing.T, file string, expire bool, loggedOut http.HandlerFunc) *sessionServer {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &sessionServer{expire: expire}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Log In | Strava</title>`+
+			`<meta name="csrf-param" content="authenticity_token" />`+
+			`<meta name="csrf-token" content="token" />`+
+			`</head><body><form id="login_form"></form></body></html>`)
+	})
+	mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.logins++
+		if r.FormValue("password") != "password" {
+			fmt.Fprint(w, `<html><head><title>Log In | Strava</title></head></html>`)
+			return
+		}
+		s.sessions++
+		s.valid = strconv.Itoa(s.sessions)
+		http.SetCookie(w, &http.Cookie{
+			Name: "_strava4_session", Value: s.valid, Path: "/", Expires: sessionExpires, HttpOnly: true})
+		fmt.Fprint(w, `<html><head><title>Dashboard | Strava</title></head></html>`)
+	})
+	mux.HandleFunc("/segments/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if cookie, err := r.Cookie("_strava4_session"); err != nil || cookie.Value != s.valid {
+			loggedOut(w, r)
+			return
+		}
+		if s.expire {
+			s.valid = ""
+		}
+		w.Write(content)
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func TestRelogin(t *testing.T) {
+	var segmentID = int64(2198806)
+	tests := []struct {
+		name      string
+		prefix    string
+		loggedOut http.HandlerFunc
+	}{
+		{"redirect", "", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}},
+		{"login page", "", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<html><head><title>Log In | Strava</title></head></html>`)
+		}},
+		{"prefixed redirect", "/strava", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/strava/login", http.StatusFound)
+		}},
+	}
+	for _, tt := range tests {
+		server := newSessionServer(t, "segment-female-yearly.1.html", true, tt.loggedOut)
+		baseURL := server.URL
+		if tt.prefix != "" {
+			prefixed := httptest.NewServer(http.StripPrefix(tt.prefix, server.Config.Handler))
+			defer prefixed.Close()
+			baseURL = prefixed.URL + tt.prefix
+		}
+		var logins []error
+		client, err := New(context.Background(), "email", "password",
+			WithBaseURL(baseURL), WithRateLimit(0), WithLoginHook(func(err error) {
+				logins = append(logins, err)
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			leaderboard, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+			if err != nil || len(leaderboard.Entries) != 4 {
+				t.Fatalf("GetLeaderboardPage(%d, %s, %s, %d) %s %d: got: %v, want: 4 entries",
+					segmentID, Genders.Female, Filters.CurrentYear, 1, tt.name, i, err)
+			}
+			// Athlete URLs are canonical regardless of the base URL.
+			if url := leaderboard.Entries[0].Athlete.URL; !strings.HasPrefix(url, BASE_URL+"/athletes/") {
+				t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) %s: got: %s, want: athlete URL on %s",
+					segmentID, Genders.Female, Filters.CurrentYear, 1, tt.name, url, BASE_URL)
+			}
+		}
+		server.Close()
+		// The first request uses the original session, each later request
+		// finds its session expired and logs in again before retrying.
+		if server.logins != 3 || len(logins) != 2 || logins[0] != nil || client.RequestCount != 5 {
+			t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) %s: got: (%d, %v, %d), want: (%d, %v, %d)",
+				segmentID, Genders.Female, Filters.CurrentYear, 1, tt.name,
+				server.logins, logins, client.RequestCount, 3, []error{nil, nil}, 5)
+		}
+	}
+}
+
+func TestReloginFailed(t *testing.T) {
+	var segmentID = int64(2198806)
+	server := newSessionServer(t, "segment-female-yearly.1.html", true, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	defer server.Close()
+
+	var logins []error
+	client, err := New(context.Background(), "email", "password",
+		WithBaseURL(server.URL), WithRateLimit(0),
+		WithCredentials(func(context.Context) (string, string, error) {
+			return "email", "changed", nil
+		}),
+		WithLoginHook(func(err error) {
+			logins = append(logins, err)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	if !errors.Is(err, ErrAuthenticationFailed) || len(logins) != 1 || !errors.Is(logins[0], ErrAuthenticationFailed) {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: (%v, %v), want: (%v, %v)",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, err, logins,
+			ErrAuthenticationFailed, []error{ErrAuthenticationFailed})
+	}
+	// The rejected credentials aren't posted again.
+	_, err = client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	if !errors.Is(err, ErrAuthenticationFailed) || len(logins) != 1 || server.logins != 2 {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) after rejected login: got: (%v, %d, %d), want: (%v, %d, %d)",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, err, len(logins), server.logins,
+			ErrAuthenticationFailed, 1, 2)
+	}
+
+	// Requests made without any credentials report the expired session.
+	_, err = NewStubClient(`<html><head><title>Log In | Strava</title></head></html>`).
+		GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	if !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: %v, want: %v",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, err, ErrSessionExpired)
+	}
+}
+
+func TestReloginConcurrent(t *testing.T) {
+	var segmentID = int64(2198806)
+	server := newSessionServer(t, "segment-female-yearly.1.html", false, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	defer server.Close()
+
+	client, err := New(context.Background(), "email", "password", WithBaseURL(server.URL), WithRateLimit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Expire the session before any requests are made.
+	server.mu.Lock()
+	server.valid = ""
+	server.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+		}()
+	}
+	wg.Wait()
+	// Only one of the requests finding the session expired logs in again.
+	if server.logins != 2 {
+		t.Errorf("concurrent GetLeaderboardPage: got: %d logins, want: %d", server.logins, 2)
+	}
+}
+
+func TestSession(t *testing.T) {
+	var segmentID = int64(2198806)
+	server := newSessionServer(t, "segment-female-yearly.1.html", false, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	defer server.Close()
+
+	client, err := New(context.Background(), "email", "password", WithBaseURL(server.URL), WithRateLimit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Cookies) != 1 || session.CSRFParam != "authenticity_token" || session.CSRFToken != "token" {
+		t.Fatalf("Session(): got: %+v, want: 1 cookie and the CSRF token", session)
+	}
+	// The cookie keeps the attributes it was set with.
+	if c := session.Cookies[0]; c.Path != "/" || !c.Expires.Equal(sessionExpires) || !c.HttpOnly {
+		t.Errorf("Session(): got: %+v, want: path %s expiring at %s and HttpOnly", c, "/", sessionExpires)
+	}
+
+	var buf bytes.Buffer
+	if err := session.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := LoadSession(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring the session doesn't log in again.
+	client, err = New(context.Background(), "email", "password",
+		WithBaseURL(server.URL), WithRateLimit(0), WithSession(restored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1); err != nil {
+		t.Fatal(err)
+	}
+	if server.logins != 1 {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) with restored session: got: %d logins, want: %d",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, server.logins, 1)
+	}
+	session, err = client.Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Cookies) != 1 || !reflect.DeepEqual(session.Cookies, restored.Cookies) {
+		t.Errorf("Session() of restored session: got: %+v, want: %+v", session.Cookies, restored.Cookies)
+	}
+
+	// An expired session is only replaced once a request finds it has expired.
+	server.mu.Lock()
+	server.valid = ""
+	server.mu.Unlock()
+	client, err = New(context.Background(), "email", "password",
+		WithBaseURL(server.URL), WithRateLimit(0), WithSession(restored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.logins != 1 {
+		t.Errorf("New(WithSession(%+v)): got: %d logins, want: %d", restored, server.logins, 1)
+	}
+	if _, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1); err != nil {
+		t.Fatal(err)
+	}
+	if server.logins != 2 {
+		t.Errorf("GetLeaderboardPage(%d, %s, %s, %d) with expired session: got: %d logins, want: %d",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, server.logins, 2)
+	}
+
+	// A session can't be used with a different frontend.
+	if _, err := New(context.Background(), "email", "password", WithSession(restored)); err == nil {
+		t.Errorf("New(WithSession(%+v)): got: %v, want: error", restored, err)
+	}
+}
+
+func TestSessionFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stravax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "session.json")
+	// An existing file has its permissions restricted.
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{
+		BaseURL:   BASE_URL,
+		Cookies:   []*http.Cookie{{Name: "_strava4_session", Value: "session"}},
+		CSRFParam: "authenticity_token",
+		CSRFToken: "token",
+	}
+	if err := session.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("SaveFile(%s): got: %s, want: %s", path, info.Mode().Perm(), os.FileMode(0600))
+	}
+	loaded, err := LoadSessionFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.BaseURL != session.BaseURL || len(loaded.Cookies) != 1 ||
+		loaded.Cookies[0].Value != "session" || loaded.CSRFToken != session.CSRFToken {
+		t.Errorf("LoadSessionFile(%s): got: %+v, want: %+v", path, loaded, session)
+	}
+}
@@ -0,0 +1,100 @@
+package stravax
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Stats summarises the HTTP requests a Client has made to Strava. Unlike
+// RequestCount, every round trip is included (eg. logging in and redirects).
+type Stats struct {
+	Frontend RequestStats `json:"frontend"`
+	API      RequestStats `json:"api"`
+}
+
+// RequestStats summarises the HTTP requests made to either the Strava frontend
+// or API. Errors counts the requests which failed without a response, and
+// StatusCodes counts the responses received by their status code.
+type RequestStats struct {
+	Requests      int64         `json:"requests"`
+	Errors        int64         `json:"errors"`
+	StatusCodes   map[int]int64 `json:"status_codes"`
+	BytesSent     int64         `json:"bytes_sent"`
+	BytesReceived int64         `json:"bytes_received"`
+}
+
+type stats struct {
+	mu       sync.Mutex
+	frontend RequestStats
+	api      RequestStats
+}
+
+func (s *stats) get(req *http.Request) *RequestStats {
+	// Token refreshes are made against the OAuth endpoints of the API.
+	if strings.HasPrefix(req.URL.Path, "/api/") || strings.HasPrefix(req.URL.Path, "/oauth/") {
+		return &s.api
+	}
+	return &s.frontend
+}
+
+// record accounts for a round trip of req, returning resp with its Body wrapped
+// so that the bytes received are counted as they are read.
+func (s *stats) record(req *http.Request, resp *http.Response, err error) *http.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs := s.get(req)
+	rs.Requests++
+	if req.ContentLength > 0 {
+		rs.BytesSent += req.ContentLength
+	}
+	if err != nil {
+		rs.Errors++
+		return resp
+	}
+	if rs.StatusCodes == nil {
+		rs.StatusCodes = make(map[int]int64)
+	}
+	rs.StatusCodes[resp.StatusCode]++
+	if resp.Body != nil {
+		resp.Body = &countingReadCloser{ReadCloser: resp.Body, stats: s, req: req}
+	}
+	return resp
+}
+
+func (s *stats) received(req *http.Request, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(req).BytesReceived += int64(n)
+}
+
+func (s *stats) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Frontend: s.frontend.copy(), API: s.api.copy()}
+}
+
+func (rs RequestStats) copy() RequestStats {
+	codes := make(map[int]int64, len(rs.StatusCodes))
+	for code, n := range rs.StatusCodes {
+		codes[code] = n
+	}
+	rs.StatusCodes = codes
+	return rs
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	stats *stats
+	req   *http.Request
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.stats.received(r.req, n)
+	}
+	return n, err
+}
@@ -8,17 +8,17 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/scheibo/strava"
 
 	"golang.org/x/net/context"
-	"golang.org/x/net/publicsuffix"
 )
 
 // USER_AGENT is the user agent we will use when making requests against the frontend.
@@ -37,30 +37,145 @@ const MAX_PER_PAGE = 100
 // of adjusting the TotalElevationGained/AverageGrade metrics.
 const CLIMB_THRESHOLD = 0.03
 
+// units maps the title of each unit Strava may display to the factor required
+// to convert a value in that unit to SI units (percentages become ratios).
+// Which units are displayed depends on the preferences of the logged in user.
+var units = map[string]float64{
+	"kilometers":          1000,
+	"miles":               1609.344,
+	"meters":              1,
+	"feet":                0.3048,
+	"kilometers per hour": 1000.0 / 3600,
+	"miles per hour":      1609.344 / 3600,
+	"meters per hour":     1,
+	"feet per hour":       0.3048,
+	"beats per minute":    1,
+	"watts":               1,
+	"percent":             0.01,
+}
+
 // Gender is the gender of the athlete.
 type Gender string
 
-// Genders represents all possible genders Strava supports.
+// Genders represents all possible genders Strava supports. All may only be
+// used to request a combined leaderboard and is never the gender of an Athlete.
 var Genders = struct {
 	Unspecified Gender
 	Male        Gender
 	Female      Gender
-}{"", "M", "F"}
+	All         Gender
+}{"", "M", "F", "all"}
+
+// Filter is the filter used on the leaderboard. Some filters (eg. age group or
+// weight class) further restrict the leaderboard by an additional query parameter.
+type Filter struct {
+	name  string
+	param string
+	value string
+}
 
-// Filter is the filter used on the leaderboard.
-type Filter string
+func (f Filter) String() string {
+	if f.param == "" {
+		return f.name
+	}
+	return fmt.Sprintf("%s=%s", f.param, f.value)
+}
 
 // Filters represents the Strava filters this client supports.
 var Filters = struct {
 	Overall     Filter
 	CurrentYear Filter
-}{"overall", "current_year"}
+	Following   Filter
+}{Filter{name: "overall"}, Filter{name: "current_year"}, Filter{name: "following"}}
+
+// myResults is not exported as a Filter because the efforts it returns do not
+// form a Leaderboard, see GetMyResults instead.
+var myResults = Filter{name: "my_results"}
+
+// DateRange restricts the leaderboard to efforts within a period of time.
+type DateRange string
+
+// DateRanges represents all the date ranges Strava supports. A DateRange may be
+// combined with any Filter.
+var DateRanges = struct {
+	AllTime   DateRange
+	Today     DateRange
+	ThisWeek  DateRange
+	ThisMonth DateRange
+	ThisYear  DateRange
+}{"", "today", "this_week", "this_month", "this_year"}
+
+// Club returns the Filter which restricts the leaderboard to members of clubID.
+func Club(clubID int64) Filter {
+	return Filter{name: "club", param: "club_id", value: strconv.FormatInt(clubID, 10)}
+}
+
+func ageGroup(value string) Filter {
+	return Filter{name: "age_group", param: "age_group", value: value}
+}
+
+// AgeGroups represents all the age group filters Strava supports.
+var AgeGroups = struct {
+	Age19AndUnder Filter
+	Age20To24     Filter
+	Age25To34     Filter
+	Age35To44     Filter
+	Age45To54     Filter
+	Age55To64     Filter
+	Age65To69     Filter
+	Age70To74     Filter
+	Age75AndOver  Filter
+}{
+	ageGroup("0_19"),
+	ageGroup("20_24"),
+	ageGroup("25_34"),
+	ageGroup("35_44"),
+	ageGroup("45_54"),
+	ageGroup("55_64"),
+	ageGroup("65_69"),
+	ageGroup("70_74"),
+	ageGroup("75_plus"),
+}
+
+func weightClass(value string) Filter {
+	return Filter{name: "weight_class", param: "weight_class", value: value}
+}
+
+// WeightClasses represents all the weight class filters Strava supports.
+var WeightClasses = struct {
+	Kg54AndUnder Filter
+	Kg55To64     Filter
+	Kg65To74     Filter
+	Kg75To84     Filter
+	Kg85To94     Filter
+	Kg95To104    Filter
+	Kg105To114   Filter
+	Kg115AndOver Filter
+}{
+	weightClass("0_54"),
+	weightClass("55_64"),
+	weightClass("65_74"),
+	weightClass("75_84"),
+	weightClass("85_94"),
+	weightClass("95_104"),
+	weightClass("105_114"),
+	weightClass("115_plus"),
+}
 
 // Athlete holds information about a Strava athlete required to render a leaderboard.
+// Gender is Genders.Unspecified when it can not be determined from the
+// leaderboard, eg. for a Genders.All leaderboard. ID is zero for professional
+// athletes, who are identified by name in their URL. URL is always on BASE_URL,
+// even if the Client was configured WithBaseURL. AvatarURL and Subscriber are
+// only known if Strava displays the athlete's avatar, which it currently only
+// does for the leader.
 type Athlete struct {
-	URL    string `json:"url"`
-	Name   string `json:"name"`
-	Gender Gender `json:"gender"`
+	ID         int64  `json:"id"`
+	URL        string `json:"url"`
+	Name       string `json:"name"`
+	Gender     Gender `json:"gender"`
+	AvatarURL  string `json:"avatar_url,omitempty"`
+	Subscriber bool   `json:"subscriber,omitempty"`
 }
 
 // LatLng represents a location on the Earth.
@@ -69,13 +184,18 @@ type LatLng struct {
 	Lng float64 `json:"lng"`
 }
 
-// Segment contains the Strava segment details.
+// Segment contains the Strava segment details. ActivityType is the sport of
+// the segment (eg. "Ride" or "Run"), and EffortCount and AthleteCount are the
+// total number of attempts and unique athletes who have attempted it.
 // NOTE: The segment information stored in the frontend leaderboard page is
 // inherently less accurate than the information from the API.
 type Segment struct {
 	ID                 int64   `json:"id"`
 	Name               string  `json:"name"`
 	Location           string  `json:"location"`
+	ActivityType       string  `json:"activity_type"`
+	EffortCount        int64   `json:"effort_count"`
+	AthleteCount       int64   `json:"athlete_count"`
 	Distance           float64 `json:"distance"`
 	AverageGrade       float64 `json:"average_grade"`
 	ElevationLow       float64 `json:"elevation_low"`
@@ -88,124 +208,286 @@ type Segment struct {
 }
 
 // LeaderboardEntry is a single entry in a leaderboard, representing the best
-// effort on a segment by a particular athlete.
+// effort on a segment by a particular athlete. AverageSpeed (m/s),
+// AverageHeartrate (bpm), AverageWatts (W) and VAM (m/h) are always in SI
+// units regardless of the logged in user's preferences, and are zero if Strava
+// does not display them for the effort (eg. AverageSpeed on run segments, which
+// display pace instead). DeviceWatts is true if AverageWatts
+// was measured by a power meter as opposed to being estimated.
 type LeaderboardEntry struct {
-	Rank        int64     `json:"rank"`
-	Athlete     Athlete   `json:"athlete"`
-	EffortID    int64     `json:"effort_id"`
-	StartDate   time.Time `json:"start_date"`
-	ElapsedTime int64     `json:"elapsed_time"`
+	Rank             int64     `json:"rank"`
+	Athlete          Athlete   `json:"athlete"`
+	EffortID         int64     `json:"effort_id"`
+	StartDate        time.Time `json:"start_date"`
+	ElapsedTime      int64     `json:"elapsed_time"`
+	AverageSpeed     float64   `json:"average_speed,omitempty"`
+	AverageHeartrate float64   `json:"average_heartrate,omitempty"`
+	AverageWatts     float64   `json:"average_watts,omitempty"`
+	DeviceWatts      bool      `json:"device_watts,omitempty"`
+	VAM              float64   `json:"vam,omitempty"`
+}
+
+// Standing is the position of the logged in athlete on a leaderboard.
+type Standing struct {
+	Rank        int64 `json:"rank"`
+	ElapsedTime int64 `json:"elapsed_time"`
 }
 
 // Leaderboard contains LeaderboardEntry objects sorted by their rank
 // according to Strava. len(Entries) may not equal EntriesCount if the
 // Leaderboard has not been completely fetched or entries were added or
-// removed from the leaderboard during fetching.
+// removed from the leaderboard during fetching. Shifted is true if the
+// leaderboard was observed to change while its pages were being fetched, in
+// which case Entries may contain duplicates or be missing entries. Viewer is the
+// Standing of the logged in athlete, or nil if they do not appear on the leaderboard.
+// Next is set if the Leaderboard was only partially fetched because of an error,
+// and may be passed to ResumeLeaderboard to fetch the remaining entries.
+// Duplicates is the number of entries which were removed because their effort
+// or athlete had already appeared on an earlier page.
 type Leaderboard struct {
 	Entries      []*LeaderboardEntry `json:"entries"`
 	EntriesCount int64               `json:"entries_count"`
+	Shifted      bool                `json:"shifted,omitempty"`
+	Duplicates   int                 `json:"duplicates,omitempty"`
+	Viewer       *Standing           `json:"viewer,omitempty"`
+	Next         *Cursor             `json:"next,omitempty"`
+	// counts is the EntriesCount of each page merged into the Leaderboard, in
+	// order. Entries may have been skipped at a boundary between two pages with
+	// different counts without it otherwise appearing to shift, eg. if an effort
+	// on an earlier page was deleted.
+	counts []int64
+}
+
+// merge appends the entries from next, the following page of the leaderboard.
+func (l *Leaderboard) merge(next *Leaderboard) {
+	if shifted(l, next) {
+		l.Shifted = true
+	}
+	if l.counts == nil {
+		l.counts = []int64{l.EntriesCount}
+	}
+	l.counts = append(l.counts, next.EntriesCount)
+	// NOTE: EntriesCount could change if new activities are uploaded or
+	// deleted during fetching, the next fetched count always takes precedence.
+	l.EntriesCount = next.EntriesCount
+	l.Viewer = next.Viewer
+	l.Entries = append(l.Entries, next.Entries...)
+}
+
+// dedup removes the entries whose effort or athlete appears earlier in the leaderboard.
+func (l *Leaderboard) dedup() {
+	efforts := make(map[int64]bool)
+	athletes := make(map[string]bool)
+	entries := l.Entries[:0]
+	for _, entry := range l.Entries {
+		if efforts[entry.EffortID] || athletes[entry.Athlete.URL] {
+			l.Duplicates++
+			continue
+		}
+		efforts[entry.EffortID] = true
+		athletes[entry.Athlete.URL] = true
+		entries = append(entries, entry)
+	}
+	l.Entries = entries
+}
+
+// Consistent returns whether the Leaderboard is internally consistent: it has
+// been completely fetched, contains EntriesCount entries each for a different
+// effort and athlete, and its ranks run from 1 with only ties in between. A
+// Leaderboard whose EntriesCount changed between pages is not consistent unless
+// the page before each such change was re-fetched (see WithRefetches).
+func (l *Leaderboard) Consistent() bool {
+	if l.Next != nil || int64(len(l.Entries)) != l.EntriesCount {
+		return false
+	}
+	for k := 1; k < len(l.counts); k++ {
+		if l.counts[k] != l.counts[k-1] {
+			return false
+		}
+	}
+	efforts := make(map[int64]bool)
+	athletes := make(map[string]bool)
+	for i, entry := range l.Entries {
+		if efforts[entry.EffortID] || athletes[entry.Athlete.URL] {
+			return false
+		}
+		if entry.Rank != int64(i+1) && (i == 0 || entry.Rank != l.Entries[i-1].Rank) {
+			return false
+		}
+		efforts[entry.EffortID] = true
+		athletes[entry.Athlete.URL] = true
+	}
+	return true
+}
+
+// shifted returns whether next, the page fetched after prev, indicates that the
+// leaderboard changed in between the two pages being fetched.
+func shifted(prev, next *Leaderboard) bool {
+	if next.EntriesCount != prev.EntriesCount {
+		return true
+	}
+	return len(prev.Entries) > 0 && len(next.Entries) > 0 &&
+		next.Entries[0].Rank < prev.Entries[len(prev.Entries)-1].Rank
+}
+
+// Effort is a single effort on a segment by the logged in athlete.
+type Effort struct {
+	EffortID    int64     `json:"effort_id"`
+	StartDate   time.Time `json:"start_date"`
+	ElapsedTime int64     `json:"elapsed_time"`
+}
+
+// Results contains every Effort on a segment by the logged in athlete, sorted
+// by ElapsedTime. Unlike a Leaderboard, an athlete may have more than one Effort.
+type Results struct {
+	Efforts []*Effort `json:"efforts"`
+}
+
+// Record is the fastest effort on a segment for a category of athletes. Only
+// the Name, Gender, AvatarURL and Subscriber fields of the Athlete are known.
+type Record struct {
+	Athlete     Athlete   `json:"athlete"`
+	EffortID    int64     `json:"effort_id"`
+	StartDate   time.Time `json:"start_date"`
+	ElapsedTime int64     `json:"elapsed_time"`
+}
+
+// Records contains the current records of a segment: the fastest Men's
+// (KOM/CR) and Women's (QOM/CR) efforts, and the logged in athlete's personal
+// record (PR). Each is nil if Strava does not display it.
+type Records struct {
+	Men   *Record `json:"men,omitempty"`
+	Women *Record `json:"women,omitempty"`
+	PR    *Record `json:"pr,omitempty"`
 }
 
 // Client is used to retrieve Segment and Leaderboard information from the
 // Strava API and frontend. Calls to Strava are rate limiting to QPS_LIMIT
-// requests/second, and the number of requests issued is tracked by
-// RequestCount.
+// requests/second (see WithRateLimit and WithLimiter), and the number of
+// requests issued (including retries, see WithRetryPolicy) is tracked by
+// RequestCount, which must be read atomically while the Client is in use.
+// Each method has a variant which takes a context.Context that can be used to
+// cancel the request(s) it makes.
+// A Client is safe for concurrent use by multiple goroutines.
 type Client struct {
 	RequestCount int64
-	throttle     <-chan time.Time
+	retries      int64
+	retryPolicy  RetryPolicy
+	logins       *logins
+	stats        *stats
+	limiter      Limiter
 	httpClient   *http.Client
+	jar          *sessionJar
 	stravaClient *strava.APIClient
-	stravaCtx    context.Context
+	tokenSource  TokenSource
+	baseURL      string
+	pageSize     int
+	concurrency  int
+	refetches    int
 }
 
-type transport struct{}
+type transport struct {
+	userAgent string
+	base      http.RoundTripper
+	stats     *stats
+}
 
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Set("User-Agent", USER_AGENT)
-	return http.DefaultTransport.RoundTrip(req)
+	req.Header.Set("User-Agent", t.userAgent)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	return t.stats.record(req, resp, err), err
 }
 
 // NewClient returns an authenticated Client for querying Strava.
 func NewClient(email, password string, accessToken ...string) (*Client, error) {
-	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
-	if err != nil {
-		return nil, err
-	}
-	httpClient := &http.Client{
-		Jar:       jar,
-		Timeout:   10 * time.Second,
-		Transport: &transport{},
-	}
-	c := &Client{
-		throttle:   time.Tick(QPS_LIMIT),
-		httpClient: httpClient,
-	}
-	if len(accessToken) > 0 && accessToken[0] != "" {
-		cfg := strava.NewConfiguration()
-		cfg.UserAgent = USER_AGENT
-		c.stravaClient = strava.NewAPIClient(cfg)
-		c.stravaCtx = context.WithValue(context.Background(), strava.ContextAccessToken, accessToken[0])
-	}
+	return NewClientContext(context.Background(), email, password, accessToken...)
+}
 
-	return c.login(email, password)
+// NewClientContext returns an authenticated Client for querying Strava, logging
+// in using ctx.
+func NewClientContext(ctx context.Context, email, password string, accessToken ...string) (*Client, error) {
+	var opts []Option
+	if len(accessToken) > 0 {
+		opts = append(opts, WithAccessToken(accessToken[0]))
+	}
+	return New(ctx, email, password, opts...)
 }
 
-func (c *Client) login(email, password string) (*Client, error) {
-	resp, err := c.httpClient.Get("https://www.strava.com/login")
+func (c *Client) login(ctx context.Context, email, password string) (*Client, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/login", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
-	doc, err := goquery.NewDocumentFromReader(io.Reader(resp.Body))
+	doc, err := newDocument(resp)
 	if err != nil {
 		return nil, err
 	}
 
 	csrfParam, ok := doc.Find("meta[name=csrf-param]").Attr("content")
 	if !ok {
-		return nil, errors.New("could not find csrf-param")
+		return nil, newLayoutError(doc, "meta[name=csrf-param]")
 	}
 	csrfToken, ok := doc.Find("meta[name=csrf-token]").Attr("content")
 	if !ok {
-		return nil, errors.New("could not find csrf-token")
+		return nil, newLayoutError(doc, "meta[name=csrf-token]")
 	}
 
-	resp, err = c.httpClient.PostForm(
-		"https://www.strava.com/session",
-		url.Values{
-			"email":       {email},
-			"password":    {password},
-			"remember_me": {"on"},
-			csrfParam:     {csrfToken}})
+	form := url.Values{
+		"email":       {email},
+		"password":    {password},
+		"remember_me": {"on"},
+		csrfParam:     {csrfToken}}
+	req, err = http.NewRequest(
+		"POST", c.baseURL+"/session", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = c.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
-	doc, err = goquery.NewDocumentFromReader(io.Reader(resp.Body))
+	doc, err = newDocument(resp)
 	if err != nil {
 		return nil, err
 	}
 
 	if doc.Find("title").Text() != "Dashboard | Strava" {
-		return nil, errors.New("login was unsuccessful")
+		return nil, ErrAuthenticationFailed
 	}
 
+	c.logins.csrfParam, c.logins.csrfToken = csrfParam, csrfToken
 	return c, nil
 }
 
 type stubResponseTransport struct {
 	http.Transport
+	mu      sync.Mutex
 	content []string
 	reqs    int
 }
 
 func (t *stubResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	statusCode := 200
 	resp := &http.Response{
 		Status:     http.StatusText(statusCode),
 		StatusCode: statusCode,
+		Request:    req,
 	}
 	if len(t.content) <= t.reqs {
 		return nil, fmt.Errorf("request for stub response %d but only %d exist", t.reqs+1, len(t.content))
@@ -218,15 +500,38 @@ func (t *stubResponseTransport) RoundTrip(req *http.Request) (*http.Response, er
 
 // NewStubClient returns content for each subsequent request that is made.
 func NewStubClient(content ...string) *Client {
-	c := &Client{}
-	c.httpClient = &http.Client{Transport: &stubResponseTransport{content: content}}
+	c := &Client{logins: &logins{}, stats: &stats{}, baseURL: BASE_URL, pageSize: MAX_PER_PAGE}
+	c.httpClient = &http.Client{Transport: &transport{
+		userAgent: USER_AGENT,
+		base:      &stubResponseTransport{content: content},
+		stats:     c.stats,
+	}}
 	return c
 }
 
+// Stats returns a summary of the HTTP requests the Client has made.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
+
 // GetSegment returns the data for the segment identified by segmentID using the Strava API.
 func (c *Client) GetSegment(segmentID int64) (*Segment, error) {
-	c.request()
-	segment, _, err := c.stravaClient.SegmentsApi.GetSegmentById(c.stravaCtx, segmentID)
+	return c.GetSegmentContext(context.Background(), segmentID)
+}
+
+// GetSegmentContext returns the data for the segment identified by segmentID using the
+// Strava API.
+func (c *Client) GetSegmentContext(ctx context.Context, segmentID int64) (*Segment, error) {
+	if c.tokenSource == nil {
+		return nil, errors.New("GetSegment requires an access token")
+	}
+	segment, rejected, err := c.getSegment(ctx, segmentID)
+	// The access token may have been revoked or expired early, in which case
+	// a TokenInvalidator can replace it before the request is retried.
+	if ts, ok := c.tokenSource.(TokenInvalidator); ok && rejected != "" {
+		ts.Invalidate(rejected)
+		segment, _, err = c.getSegment(ctx, segmentID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -234,6 +539,9 @@ func (c *Client) GetSegment(segmentID int64) (*Segment, error) {
 	s := &Segment{ID: segmentID}
 	s.Name = segment.Name
 	s.Location = fmt.Sprintf("%s, %s", segment.City, segment.State)
+	s.ActivityType = string(segment.ActivityType)
+	s.EffortCount = int64(segment.EffortCount)
+	s.AthleteCount = int64(segment.AthleteCount)
 	s.Distance = float64(segment.Distance)
 	s.ElevationLow = float64(segment.ElevationLow)
 	s.ElevationHigh = float64(segment.ElevationHigh)
@@ -253,72 +561,307 @@ func (c *Client) GetSegment(segmentID int64) (*Segment, error) {
 	return s, nil
 }
 
+// getSegment returns the segment identified by segmentID from the Strava API.
+// If the final attempt to retrieve it failed because the API rejected its
+// access token as unauthorized, that access token is also returned.
+func (c *Client) getSegment(ctx context.Context, segmentID int64) (*strava.DetailedSegment, string, error) {
+	var segment strava.DetailedSegment
+	var rejected string
+	err := c.retry(ctx, func() error {
+		rejected = ""
+		token, err := c.tokenSource.Token(context.WithValue(ctx, httpClientKey{}, c.httpClient))
+		if err != nil {
+			return err
+		}
+		ctx := context.WithValue(ctx, strava.ContextAccessToken, token.AccessToken)
+		var resp *http.Response
+		segment, resp, err = c.stravaClient.SegmentsApi.GetSegmentById(ctx, segmentID)
+		if resp != nil && resp.StatusCode != http.StatusOK {
+			if resp.StatusCode == http.StatusUnauthorized {
+				rejected = token.AccessToken
+			}
+			return newStatusError(resp.Request.URL.String(), resp)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, rejected, err
+	}
+	return &segment, "", nil
+}
+
 // GetLeaderboardAndSegment returns the leaderboard of segmentID for the specified gender
-// and filter as well the segment details.
-func (c *Client) GetLeaderboardAndSegment(segmentID int64, gender Gender, filter Filter) (*Leaderboard, *Segment, error) {
-	return c.getLeaderboard(segmentID, gender, filter, true)
+// and filter as well the segment details. The leaderboard may optionally be
+// restricted to a dateRange.
+func (c *Client) GetLeaderboardAndSegment(segmentID int64, gender Gender, filter Filter, dateRange ...DateRange) (*Leaderboard, *Segment, error) {
+	return c.GetLeaderboardAndSegmentContext(context.Background(), segmentID, gender, filter, dateRange...)
+}
+
+// GetLeaderboardAndSegmentContext returns the leaderboard of segmentID for the specified
+// gender and filter as well the segment details. The leaderboard may optionally be
+// restricted to a dateRange.
+func (c *Client) GetLeaderboardAndSegmentContext(ctx context.Context, segmentID int64, gender Gender, filter Filter, dateRange ...DateRange) (*Leaderboard, *Segment, error) {
+	return c.getLeaderboard(ctx, c.newCursor(segmentID, gender, filter, optionalDateRange(dateRange)), true)
 }
 
 // GetLeaderboard returns the leaderboard of segmentID for the specified gender and filter.
-func (c *Client) GetLeaderboard(segmentID int64, gender Gender, filter Filter) (*Leaderboard, error) {
-	leaderboard, _, err := c.getLeaderboard(segmentID, gender, filter, false)
+// The leaderboard may optionally be restricted to a dateRange.
+// If a page after the first fails to be fetched the partial leaderboard is
+// returned along with the error, see Leaderboard.Next.
+func (c *Client) GetLeaderboard(segmentID int64, gender Gender, filter Filter, dateRange ...DateRange) (*Leaderboard, error) {
+	return c.GetLeaderboardContext(context.Background(), segmentID, gender, filter, dateRange...)
+}
+
+// GetLeaderboardContext returns the leaderboard of segmentID for the specified gender and
+// filter. The leaderboard may optionally be restricted to a dateRange.
+// If a page after the first fails to be fetched the partial leaderboard is
+// returned along with the error, see Leaderboard.Next.
+func (c *Client) GetLeaderboardContext(ctx context.Context, segmentID int64, gender Gender, filter Filter, dateRange ...DateRange) (*Leaderboard, error) {
+	leaderboard, _, err := c.getLeaderboard(ctx, c.newCursor(segmentID, gender, filter, optionalDateRange(dateRange)), false)
 	return leaderboard, err
 }
 
 // GetLeaderboardPageAndSegment returns the specified page of the leaderboard for segmentID for
-// given gender and filter as well as the segment details.
-func (c *Client) GetLeaderboardPageAndSegment(segmentID int64, gender Gender, filter Filter, page int) (*Leaderboard, *Segment, error) {
-	leaderboard, segment, _, err := c.getLeaderboardPageForURL(getLeaderboardURL(segmentID, gender, filter), gender, page, true)
+// given gender and filter as well as the segment details. The leaderboard may
+// optionally be restricted to a dateRange.
+func (c *Client) GetLeaderboardPageAndSegment(segmentID int64, gender Gender, filter Filter, page int, dateRange ...DateRange) (*Leaderboard, *Segment, error) {
+	return c.GetLeaderboardPageAndSegmentContext(context.Background(), segmentID, gender, filter, page, dateRange...)
+}
+
+// GetLeaderboardPageAndSegmentContext returns the specified page of the leaderboard for
+// segmentID for given gender and filter as well as the segment details. The leaderboard
+// may optionally be restricted to a dateRange.
+func (c *Client) GetLeaderboardPageAndSegmentContext(ctx context.Context, segmentID int64, gender Gender, filter Filter, page int, dateRange ...DateRange) (*Leaderboard, *Segment, error) {
+	url := c.getLeaderboardURL(segmentID, gender, filter, optionalDateRange(dateRange))
+	leaderboard, segment, _, err := c.getLeaderboardPageForURL(ctx, url, gender, page, true)
 	return leaderboard, segment, err
 }
 
 // GetLeaderboardPage returns the specified page of the leaderboard for segmentID for given gender and filter.
-func (c *Client) GetLeaderboardPage(segmentID int64, gender Gender, filter Filter, page int) (*Leaderboard, error) {
-	leaderboard, _, _, err := c.getLeaderboardPageForURL(getLeaderboardURL(segmentID, gender, filter), gender, page, false)
+// The leaderboard may optionally be restricted to a dateRange.
+func (c *Client) GetLeaderboardPage(segmentID int64, gender Gender, filter Filter, page int, dateRange ...DateRange) (*Leaderboard, error) {
+	return c.GetLeaderboardPageContext(context.Background(), segmentID, gender, filter, page, dateRange...)
+}
+
+// GetLeaderboardPageContext returns the specified page of the leaderboard for segmentID for
+// given gender and filter. The leaderboard may optionally be restricted to a dateRange.
+func (c *Client) GetLeaderboardPageContext(ctx context.Context, segmentID int64, gender Gender, filter Filter, page int, dateRange ...DateRange) (*Leaderboard, error) {
+	url := c.getLeaderboardURL(segmentID, gender, filter, optionalDateRange(dateRange))
+	leaderboard, _, _, err := c.getLeaderboardPageForURL(ctx, url, gender, page, false)
 	return leaderboard, err
 }
 
-func (c *Client) getLeaderboard(segmentID int64, gender Gender, filter Filter, includeSegment bool) (*Leaderboard, *Segment, error) {
+// GetClubLeaderboard returns the leaderboard of segmentID for the specified gender
+// restricted to members of clubID. The leaderboard may optionally be restricted
+// to a dateRange. It is shorthand for GetLeaderboard with Club(clubID).
+func (c *Client) GetClubLeaderboard(segmentID, clubID int64, gender Gender, dateRange ...DateRange) (*Leaderboard, error) {
+	return c.GetLeaderboard(segmentID, gender, Club(clubID), dateRange...)
+}
+
+// GetClubLeaderboardContext returns the leaderboard of segmentID for the specified
+// gender restricted to members of clubID. The leaderboard may optionally be
+// restricted to a dateRange. It is shorthand for GetLeaderboardContext with
+// Club(clubID).
+func (c *Client) GetClubLeaderboardContext(ctx context.Context, segmentID, clubID int64, gender Gender, dateRange ...DateRange) (*Leaderboard, error) {
+	return c.GetLeaderboardContext(ctx, segmentID, gender, Club(clubID), dateRange...)
+}
+
+// GetClubLeaderboardPage returns the specified page of the leaderboard for segmentID
+// for the given gender restricted to members of clubID. The leaderboard may
+// optionally be restricted to a dateRange. It is shorthand for GetLeaderboardPage
+// with Club(clubID).
+func (c *Client) GetClubLeaderboardPage(segmentID, clubID int64, gender Gender, page int, dateRange ...DateRange) (*Leaderboard, error) {
+	return c.GetLeaderboardPage(segmentID, gender, Club(clubID), page, dateRange...)
+}
+
+// GetClubLeaderboardPageContext returns the specified page of the leaderboard for
+// segmentID for the given gender restricted to members of clubID. The leaderboard
+// may optionally be restricted to a dateRange. It is shorthand for
+// GetLeaderboardPageContext with Club(clubID).
+func (c *Client) GetClubLeaderboardPageContext(ctx context.Context, segmentID, clubID int64, gender Gender, page int, dateRange ...DateRange) (*Leaderboard, error) {
+	return c.GetLeaderboardPageContext(ctx, segmentID, gender, Club(clubID), page, dateRange...)
+}
+
+// getLeaderboard fetches the leaderboard described by cursor from cursor.Page
+// onwards. If a page after the first fails to be fetched the entries fetched so
+// far are returned along with the error, and the Next cursor of the leaderboard
+// is set to where fetching should resume.
+func (c *Client) getLeaderboard(ctx context.Context, cursor Cursor, includeSegment bool) (*Leaderboard, *Segment, error) {
 	var next *Leaderboard
-	url := getLeaderboardURL(segmentID, gender, filter)
 
-	page := 1
+	if cursor.PageSize != c.pageSize {
+		return nil, nil, fmt.Errorf("cursor page size %d does not match client page size %d", cursor.PageSize, c.pageSize)
+	}
+	url := c.getLeaderboardURL(cursor.SegmentID, cursor.Gender, cursor.Filter, cursor.DateRange)
 	leaderboard, segment, final, err :=
-		c.getLeaderboardPageForURL(url, gender, page, includeSegment)
+		c.getLeaderboardPageForURL(ctx, url, cursor.Gender, cursor.Page, includeSegment)
 	if err != nil {
 		return nil, nil, err
 	}
+	if cursor.Page > 1 {
+		cursor.resume(leaderboard)
+	}
+	offset := len(leaderboard.Entries)
 
-	for ; !final; page++ {
+	page := cursor.Page + 1
+	if !final && c.concurrency > 1 {
+		page, final, err = c.getLeaderboardPagesConcurrently(ctx, url, cursor.Gender, leaderboard, page)
+	}
+
+	for !final && err == nil {
 		next, _, final, err =
 			c.getLeaderboardPageForURL(
-				url, gender, page, false)
-		if err != nil {
-			return nil, nil, err
+				ctx, url, cursor.Gender, page, false)
+		if err == nil {
+			leaderboard.merge(next)
+			page++
 		}
-		// NOTE: EntriesCount could change if new activities are uploaded or
-		// deleted during fetching, the next fetched count always takes precedence.
-		leaderboard.EntriesCount = next.EntriesCount
-		leaderboard.Entries = append(leaderboard.Entries, next.Entries...)
+	}
+	if err != nil {
+		leaderboard.dedup()
+		leaderboard.Next = cursor.advance(leaderboard, page)
+		return leaderboard, segment, err
 	}
 
+	c.reconcile(ctx, url, cursor.Gender, leaderboard, cursor.Page, offset)
+	leaderboard.dedup()
 	return leaderboard, segment, nil
 }
 
-func (c *Client) getLeaderboardPageForURL(url string, gender Gender, page int, includeSegment bool) (*Leaderboard, *Segment, bool, error) {
+// reconcile re-fetches the page before each page boundary of leaderboard at which
+// the leaderboard appears to have shifted or its EntriesCount changed, up to
+// c.refetches pages in total, so that the entries either side of the boundary
+// were fetched after the change. As a re-fetched page may in turn be
+// inconsistent with the page before it, that boundary is then checked again.
+// The leaderboard was fetched from page first, whose entries end at offset.
+// Refetching is best effort, any remaining inconsistency is reported by
+// Consistent.
+func (c *Client) reconcile(ctx context.Context, url string, gender Gender, leaderboard *Leaderboard, first, offset int) {
+	refetches := c.refetches
+	counts := leaderboard.counts
+	// k is the index of the page after the boundary being checked, relative to first.
+	for k := 1; k < len(counts) && refetches > 0; {
+		i := offset + (k-1)*c.pageSize
+		start := i - c.pageSize
+		if start < 0 || i > len(leaderboard.Entries) || (counts[k] == counts[k-1] && (i == len(leaderboard.Entries) ||
+			!shiftedAt(leaderboard.Entries[start:i], leaderboard.Entries[i], int64((first+k-1)*c.pageSize+1)))) {
+			k++
+			continue
+		}
+		refetches--
+		prev, _, _, err := c.getLeaderboardPageForURL(ctx, url, gender, first+k-1, false)
+		if err != nil {
+			return
+		}
+		if len(prev.Entries) != c.pageSize {
+			k++
+			continue
+		}
+		copy(leaderboard.Entries[start:i], prev.Entries)
+		counts[k-1] = prev.EntriesCount
+		if k > 1 {
+			k--
+		}
+	}
+}
+
+// shiftedAt returns whether next, the first entry of a page which begins at rank,
+// is inconsistent with prev, the entries of the page before it.
+func shiftedAt(prev []*LeaderboardEntry, next *LeaderboardEntry, rank int64) bool {
+	if next.Rank != rank && next.Rank != prev[len(prev)-1].Rank {
+		return true
+	}
+	for _, entry := range prev {
+		if entry.EffortID == next.EffortID || entry.Athlete.URL == next.Athlete.URL {
+			return true
+		}
+	}
+	return false
+}
+
+// getLeaderboardPagesConcurrently fetches the pages from first onwards which the
+// EntriesCount of leaderboard indicates exist, c.concurrency pages at a time,
+// and merges them into leaderboard in order. It returns the next page to fetch
+// and whether the final page has already been fetched. If a page fails to be
+// fetched, the pages before it are still merged and it is the next page returned.
+func (c *Client) getLeaderboardPagesConcurrently(ctx context.Context, url string, gender Gender, leaderboard *Leaderboard, first int) (int, bool, error) {
+	type result struct {
+		leaderboard *Leaderboard
+		final       bool
+	}
+
+	last := int((leaderboard.EntriesCount + int64(c.pageSize) - 1) / int64(c.pageSize))
+	if last < first {
+		return first, false, nil
+	}
+	workers := c.concurrency
+	if workers > last-first+1 {
+		workers = last - first + 1
+	}
+
+	// After an error no further pages are requested, but the pages already
+	// being fetched are allowed to complete so they can be returned.
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+	results := make([]result, last+1)
+	pages := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				next, _, final, err := c.getLeaderboardPageForURL(ctx, url, gender, page, false)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+					continue
+				}
+				results[page] = result{next, final}
+			}
+		}()
+	}
+feed:
+	for page := first; page <= last; page++ {
+		select {
+		case pages <- page:
+		case <-failed:
+			break feed
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(pages)
+	wg.Wait()
+
+	for page := first; page <= last; page++ {
+		if results[page].leaderboard == nil {
+			if firstErr != nil {
+				return page, false, firstErr
+			}
+			return page, false, ctx.Err()
+		}
+		leaderboard.merge(results[page].leaderboard)
+		if results[page].final {
+			// The leaderboard must have shrunk if there were fewer pages than expected.
+			if page < last {
+				leaderboard.Shifted = true
+			}
+			return page + 1, true, nil
+		}
+	}
+	return last + 1, false, nil
+}
+
+func (c *Client) getLeaderboardPageForURL(ctx context.Context, url string, gender Gender, page int, includeSegment bool) (*Leaderboard, *Segment, bool, error) {
 	var leaderboard *Leaderboard
 	var segment *Segment
 	var final bool
-	var err error
-
-	c.request()
-	resp, err := c.httpClient.Get(fmt.Sprintf("%s&page=%d", url, page))
-	if err != nil {
-		return nil, nil, false, err
-	}
 
-	defer resp.Body.Close()
-	doc, err := goquery.NewDocumentFromReader(io.Reader(resp.Body))
+	doc, err := c.getPage(ctx, url, page)
 	if err != nil {
 		return nil, nil, false, err
 	}
@@ -343,71 +886,275 @@ func (c *Client) getLeaderboardPageForURL(url string, gender Gender, page int, i
 	return leaderboard, segment, final, nil
 }
 
-func (c *Client) request() {
-	if c.throttle != nil {
-		<-c.throttle // rate limiting
+// GetMyResults returns all of the logged in athlete's efforts on segmentID. The
+// results may optionally be restricted to a dateRange.
+func (c *Client) GetMyResults(segmentID int64, dateRange ...DateRange) (*Results, error) {
+	return c.GetMyResultsContext(context.Background(), segmentID, dateRange...)
+}
+
+// GetMyResultsContext returns all of the logged in athlete's efforts on segmentID.
+// The results may optionally be restricted to a dateRange.
+func (c *Client) GetMyResultsContext(ctx context.Context, segmentID int64, dateRange ...DateRange) (*Results, error) {
+	var results Results
+	url := c.getLeaderboardURL(segmentID, Genders.Unspecified, myResults, optionalDateRange(dateRange))
+
+	for page, final := 1, false; !final; page++ {
+		next, f, err := c.getMyResultsPageForURL(ctx, url, page)
+		if err != nil {
+			return nil, err
+		}
+		final = f
+		results.Efforts = append(results.Efforts, next.Efforts...)
+	}
+
+	return &results, nil
+}
+
+// GetMyResultsPage returns the specified page of the logged in athlete's efforts
+// on segmentID. The results may optionally be restricted to a dateRange.
+func (c *Client) GetMyResultsPage(segmentID int64, page int, dateRange ...DateRange) (*Results, error) {
+	return c.GetMyResultsPageContext(context.Background(), segmentID, page, dateRange...)
+}
+
+// GetMyResultsPageContext returns the specified page of the logged in athlete's
+// efforts on segmentID. The results may optionally be restricted to a dateRange.
+func (c *Client) GetMyResultsPageContext(ctx context.Context, segmentID int64, page int, dateRange ...DateRange) (*Results, error) {
+	url := c.getLeaderboardURL(segmentID, Genders.Unspecified, myResults, optionalDateRange(dateRange))
+	results, _, err := c.getMyResultsPageForURL(ctx, url, page)
+	return results, err
+}
+
+func (c *Client) getMyResultsPageForURL(ctx context.Context, url string, page int) (*Results, bool, error) {
+	doc, err := c.getPage(ctx, url, page)
+	if err != nil {
+		return nil, false, err
+	}
+
+	results, err := parseResults(doc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, len(results.Efforts) == 0 || isFinalPage(doc), nil
+}
+
+// GetRecords returns the current records of segmentID.
+func (c *Client) GetRecords(segmentID int64) (*Records, error) {
+	return c.GetRecordsContext(context.Background(), segmentID)
+}
+
+// GetRecordsContext returns the current records of segmentID.
+func (c *Client) GetRecordsContext(ctx context.Context, segmentID int64) (*Records, error) {
+	records, _, err := c.getRecords(ctx, segmentID, false)
+	return records, err
+}
+
+// GetRecordsAndSegment returns the current records of segmentID as well as the
+// segment details.
+func (c *Client) GetRecordsAndSegment(segmentID int64) (*Records, *Segment, error) {
+	return c.GetRecordsAndSegmentContext(context.Background(), segmentID)
+}
+
+// GetRecordsAndSegmentContext returns the current records of segmentID as well as
+// the segment details.
+func (c *Client) GetRecordsAndSegmentContext(ctx context.Context, segmentID int64) (*Records, *Segment, error) {
+	return c.getRecords(ctx, segmentID, true)
+}
+
+func (c *Client) getRecords(ctx context.Context, segmentID int64, includeSegment bool) (*Records, *Segment, error) {
+	var segment *Segment
+
+	doc, err := c.getDocument(ctx, fmt.Sprintf("%s/segments/%d", c.baseURL, segmentID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if includeSegment {
+		segment, err = parseSegment(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	records, err := parseRecords(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return records, segment, nil
+}
+
+func (c *Client) getPage(ctx context.Context, url string, page int) (*goquery.Document, error) {
+	return c.getDocument(ctx, fmt.Sprintf("%s&page=%d", url, page))
+}
+
+func (c *Client) getDocument(ctx context.Context, url string) (*goquery.Document, error) {
+	var doc *goquery.Document
+	get := func() error {
+		return c.retry(ctx, func() error {
+			var err error
+			doc, err = c.fetchDocument(ctx, url)
+			return err
+		})
 	}
-	c.RequestCount++
+
+	generation := c.logins.current()
+	err := get()
+	if errors.Is(err, ErrSessionExpired) && c.logins.credentials != nil {
+		if err := c.relogin(ctx, generation); err != nil {
+			return nil, err
+		}
+		err = get()
+	}
+	return doc, err
 }
 
-func getLeaderboardURL(segmentID int64, gender Gender, filter Filter) string {
-	url := fmt.Sprintf("https://www.strava.com/segments/%d?", segmentID)
+func (c *Client) fetchDocument(ctx context.Context, url string) (*goquery.Document, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	// Strava redirects to the login page instead of the requested page once the
+	// session has expired.
+	if login := c.loginPath(); resp.Request.URL.Path == login && req.URL.Path != login {
+		return nil, ErrSessionExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(url, resp)
+	}
+	doc, err := newDocument(resp)
+	if err != nil {
+		return nil, err
+	}
+	if loggedOut(doc) {
+		return nil, ErrSessionExpired
+	}
+	return doc, nil
+}
+
+// newDocument parses the body of resp, recording the URL it was retrieved from.
+func newDocument(resp *http.Response) (*goquery.Document, error) {
+	doc, err := goquery.NewDocumentFromReader(io.Reader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Request != nil {
+		doc.Url = resp.Request.URL
+	}
+	return doc, nil
+}
+
+func (c *Client) request(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&c.RequestCount, 1)
+	return nil
+}
+
+func optionalDateRange(dateRange []DateRange) DateRange {
+	if len(dateRange) > 0 {
+		return dateRange[0]
+	}
+	return DateRanges.AllTime
+}
+
+func (c *Client) getLeaderboardURL(segmentID int64, gender Gender, filter Filter, dateRange DateRange) string {
+	params := url.Values{}
 	// Strava doesn't respect current_year properly without a date_range
-	if filter == Filters.CurrentYear {
-		url = fmt.Sprintf("%sdate_range=this_year&", url)
+	if dateRange == DateRanges.AllTime && filter == Filters.CurrentYear {
+		dateRange = DateRanges.ThisYear
+	}
+	if dateRange != DateRanges.AllTime {
+		params.Set("date_range", string(dateRange))
+	}
+	params.Set("filter", filter.name)
+	if filter.param != "" {
+		params.Set(filter.param, filter.value)
 	}
+	if gender != Genders.Unspecified {
+		params.Set("gender", string(gender))
+	}
+	params.Set("per_page", strconv.Itoa(c.pageSize))
 	return fmt.Sprintf(
-		"%sfilter=%s&gender=%s&per_page=%d", url, filter, gender, MAX_PER_PAGE)
+		"%s/segments/%d?%s", c.baseURL, segmentID, params.Encode())
 }
 
 func parseSegment(doc *goquery.Document) (*Segment, error) {
 	s := &Segment{}
 	attr, ok := doc.Find(".segment-name button").Attr("data-segment-id")
 	if !ok {
-		return nil, errors.New("could not find segment ID")
+		return nil, newLayoutError(doc, ".segment-name button[data-segment-id]")
 	}
 	id, err := parseInt(attr)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(doc, 0, attr, err)
 	}
 	s.ID = id
 
 	div := doc.Find(".segment-heading").First()
 	name, ok := div.Find(".segment-name span[data-full-name]").Attr("data-full-name")
 	if !ok {
-		return nil, errors.New("could not find segment name")
+		return nil, newLayoutError(doc, ".segment-name span[data-full-name]")
 	}
 	s.Name = name
 	s.Location = strings.TrimSpace(
 		div.Find(".location").Contents().Not("strong").Text())
+	s.ActivityType = strings.TrimSuffix(
+		strings.TrimSpace(div.Find(".location strong").Text()), " Segment")
+
+	// eg. "3,560 Attempts By 612 People". The counts are left at zero if
+	// Strava doesn't display them.
+	if attempts := strings.Fields(div.Find(".stat.attempts .stat-subtext").Text()); len(attempts) > 0 {
+		if len(attempts) != 5 {
+			return nil, newParseError(doc, 0, strings.Join(attempts, " "), errors.New("unexpected attempts format"))
+		}
+		s.EffortCount, err = parseInt(strings.Replace(attempts[0], ",", "", -1))
+		if err != nil {
+			return nil, newParseError(doc, 0, attempts[0], err)
+		}
+		s.AthleteCount, err = parseInt(strings.Replace(attempts[3], ",", "", -1))
+		if err != nil {
+			return nil, newParseError(doc, 0, attempts[3], err)
+		}
+	}
 
 	stats := div.Find(".stat-text")
 
-	val, err := parseStat(stats, 0)
+	val, err := parseStat(doc, stats, 0)
 	if err != nil {
 		return nil, err
 	}
-	s.Distance = val * 1000
+	s.Distance = val
 
-	gr, err := parseStat(stats, 1)
+	gr, err := parseStat(doc, stats, 1)
 	if err != nil {
 		return nil, err
 	}
-	gr = gr / 100
 
-	val, err = parseStat(stats, 2)
+	val, err = parseStat(doc, stats, 2)
 	if err != nil {
 		return nil, err
 	}
 	s.ElevationLow = val
 
-	val, err = parseStat(stats, 3)
+	val, err = parseStat(doc, stats, 3)
 	if err != nil {
 		return nil, err
 	}
 	s.ElevationHigh = val
 
-	gain, err := parseStat(stats, 4)
+	gain, err := parseStat(doc, stats, 4)
 	if err != nil {
 		return nil, err
 	}
@@ -424,20 +1171,60 @@ func parseSegment(doc *goquery.Document) (*Segment, error) {
 	return s, nil
 }
 
-func parseStat(s *goquery.Selection, i int) (float64, error) {
-	return parseFloat(s.Eq(i).Contents().Not("abbr").Text())
+func parseStat(doc *goquery.Document, s *goquery.Selection, i int) (float64, error) {
+	val, err := parseValue(s.Eq(i))
+	if err != nil {
+		return 0, newParseError(doc, 0, strings.TrimSpace(s.Eq(i).Text()), err)
+	}
+	return val, nil
 }
 
 func parseLeaderboard(doc *goquery.Document, gender Gender) (*Leaderboard, error) {
 	var leaderboard Leaderboard
-	split := strings.Split(doc.Find(".standing").Text(), "/")
+	var row int
+	var text string
+
+	strong := doc.Find(".standing strong")
+	if strong.Length() == 0 {
+		return nil, newLayoutError(doc, ".standing strong")
+	}
+	split := strings.Split(strong.Text(), "/")
 	val, err := parseInt(strings.TrimSpace(split[len(split)-1]))
 	if err != nil {
-		return nil, err
+		return nil, newParseError(doc, 0, strings.TrimSpace(strong.Text()), err)
 	}
 	leaderboard.EntriesCount = val
 
+	// The logged in athlete's place and best time are "-" if they have no effort.
+	if r := strings.TrimSpace(split[0]); len(split) == 2 && r != "-" {
+		standing := new(Standing)
+		standing.Rank, err = parseInt(r)
+		if err != nil {
+			return nil, newParseError(doc, 0, r, err)
+		}
+		t := strings.TrimSpace(doc.Find(".time strong").Text())
+		standing.ElapsedTime, err = parseElapsedTime(t)
+		if err != nil {
+			return nil, newParseError(doc, 0, t, err)
+		}
+		leaderboard.Viewer = standing
+	}
+
+	// The combined leaderboard doesn't indicate the gender of each athlete.
+	if gender == Genders.All {
+		gender = Genders.Unspecified
+	}
+
+	// Which of the columns after the date are displayed depends on the sport of
+	// the segment (eg. runs display pace instead of speed and no power), so
+	// they are found by their header.
+	columns := make(map[string]int)
+	doc.Find(".table-leaderboard thead th").Each(func(i int, th *goquery.Selection) {
+		columns[strings.TrimSpace(th.Text())] = i
+	})
+
 	doc.Find(".table-leaderboard tbody tr").EachWithBreak(func(i int, tr *goquery.Selection) bool {
+		row, text = i+1, rowText(tr)
 		tds := tr.Find("td")
 		entry := new(LeaderboardEntry)
 
@@ -454,15 +1241,28 @@ func parseLeaderboard(doc *goquery.Document, gender Gender) (*Leaderboard, error
 		td := tds.Eq(1)
 		href, ok := td.Find("a").Attr("href")
 		if !ok {
-			err = errors.New("could not find athlete URL")
+			err = newLayoutError(doc, ".table-leaderboard tbody tr td a[href]")
 			return false
 		}
-		url := fmt.Sprintf("https://www.strava.com%s", href)
+		// NOTE: professional athletes are linked to by name (/pros/:name),
+		// in which case their ID is not available.
+		var id int64
+		if strings.HasPrefix(href, "/athletes/") {
+			id, err = parseInt(strings.TrimPrefix(href, "/athletes/"))
+			if err != nil {
+				return false
+			}
+		}
+		url := BASE_URL + href
 		entry.Athlete = Athlete{
+			ID:     id,
 			URL:    url,
 			Name:   strings.TrimSpace(td.Text()),
 			Gender: gender,
 		}
+		avatar := tds.Eq(0).Find(".avatar-athlete")
+		entry.Athlete.AvatarURL, _ = avatar.Find("img.avatar-img").Attr("src")
+		entry.Athlete.Subscriber = avatar.Find(".avatar-badge .icon-badge-premium").Length() > 0
 		td = tds.Eq(2)
 		entry.StartDate, err =
 			time.Parse("Jan 2, 2006", strings.TrimSpace(td.Text()))
@@ -471,29 +1271,170 @@ func parseLeaderboard(doc *goquery.Document, gender Gender) (*Leaderboard, error
 		}
 		href, ok = td.Find("a").Attr("href")
 		if !ok {
-			err = errors.New("could not find effort ID")
+			err = newLayoutError(doc, ".table-leaderboard tbody tr td a[href]")
 			return false
 		}
-		var id int64
 		id, err = parseInt(strings.TrimPrefix(href, "/segment_efforts/"))
 		if err != nil {
 			return false
 		}
 		entry.EffortID = id
 
+		// NOTE: the optional columns are left at zero if their value can't be
+		// parsed rather than failing the entire page.
+		entry.AverageSpeed, _ = parseValue(column(tds, columns, "Speed"))
+		entry.AverageHeartrate, _ = parseValue(column(tds, columns, "HR"))
+		td = column(tds, columns, "Power")
+		entry.AverageWatts, _ = parseValue(td)
+		entry.DeviceWatts = td.Find("img.power-meter").Length() > 0
+		entry.VAM, _ = parseValue(column(tds, columns, "VAM"))
+
 		entry.ElapsedTime, _ =
-			parseElapsedTime(strings.TrimSpace(tds.Eq(7).Text()))
+			parseElapsedTime(strings.TrimSpace(tds.Last().Text()))
 
 		leaderboard.Entries = append(leaderboard.Entries, entry)
 		return true
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, newParseError(doc, row, text, err)
 	}
 	return &leaderboard, nil
 }
 
+// column returns the cell of tds in the column with header, which is empty if
+// there is no such column.
+func column(tds *goquery.Selection, columns map[string]int, header string) *goquery.Selection {
+	if i, ok := columns[header]; ok {
+		return tds.Eq(i)
+	}
+	return tds.Slice(0, 0)
+}
+
+// parseValue returns the value displayed in s converted to SI units according
+// to its abbr.unit, or 0 if the value is not available ("-").
+func parseValue(s *goquery.Selection) (float64, error) {
+	str := strings.TrimSpace(s.Contents().Not("abbr, img").Text())
+	if str == "" || str == "-" {
+		return 0, nil
+	}
+	val, err := parseFloat(strings.Replace(str, ",", "", -1))
+	if err != nil {
+		return 0, err
+	}
+
+	factor := 1.0
+	if abbr := s.Find("abbr.unit"); abbr.Length() > 0 {
+		title, _ := abbr.Attr("title")
+		f, ok := units[title]
+		if !ok {
+			return 0, fmt.Errorf("unknown unit %q", title)
+		}
+		factor = f
+	}
+	return val * factor, nil
+}
+
+func parseRecords(doc *goquery.Document) (*Records, error) {
+	var records Records
+	var row int
+	var text string
+	var err error
+
+	doc.Find(".kom-qom .results").EachWithBreak(func(i int, div *goquery.Selection) bool {
+		row, text = i+1, rowText(div)
+		record := new(Record)
+		result := div.Find(".result")
+
+		label := strings.TrimSpace(result.Find("strong").Text())
+		switch {
+		case label == "KOM" || (label == "CR" && records.Men == nil):
+			record.Athlete.Gender = Genders.Male
+			records.Men = record
+		case label == "QOM" || label == "CR":
+			record.Athlete.Gender = Genders.Female
+			records.Women = record
+		case label == "PR":
+			records.PR = record
+		default:
+			return true
+		}
+
+		record.Athlete.Name = strings.TrimSpace(result.Find(".athlete").Text())
+		avatar := div.Find(".avatar-athlete")
+		record.Athlete.AvatarURL, _ = avatar.Find("img.avatar-img").Attr("src")
+		record.Athlete.Subscriber = avatar.Find(".avatar-badge .icon-badge-premium").Length() > 0
+
+		a := result.Find(".timestamp a")
+		record.StartDate, err = time.Parse("Jan 2, 2006", strings.TrimSpace(a.Text()))
+		if err != nil {
+			return false
+		}
+		href, ok := a.Attr("href")
+		if !ok {
+			err = newLayoutError(doc, ".kom-qom .results .timestamp a[href]")
+			return false
+		}
+		record.EffortID, err = parseInt(strings.TrimPrefix(href, "/segment_efforts/"))
+		if err != nil {
+			return false
+		}
+		record.ElapsedTime, err = parseElapsedTime(
+			strings.TrimSpace(result.Contents().Not("div, strong, span").Text()))
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, newParseError(doc, row, text, err)
+	}
+	return &records, nil
+}
+
+func parseResults(doc *goquery.Document) (*Results, error) {
+	var results Results
+	var row int
+	var text string
+	var err error
+
+	doc.Find(".table-leaderboard tbody tr").EachWithBreak(func(i int, tr *goquery.Selection) bool {
+		row, text = i+1, rowText(tr)
+		tds := tr.Find("td")
+		effort := new(Effort)
+
+		td := tds.Eq(1)
+		effort.StartDate, err =
+			time.Parse("Jan 2, 2006", strings.TrimSpace(td.Text()))
+		if err != nil {
+			return false
+		}
+		href, ok := td.Find("a").Attr("href")
+		if !ok {
+			err = newLayoutError(doc, ".table-leaderboard tbody tr td a[href]")
+			return false
+		}
+		effort.EffortID, err = parseInt(strings.TrimPrefix(href, "/segment_efforts/"))
+		if err != nil {
+			return false
+		}
+
+		effort.ElapsedTime, _ =
+			parseElapsedTime(strings.TrimSpace(tds.Last().Text()))
+
+		results.Efforts = append(results.Efforts, effort)
+		return true
+	})
+
+	if err != nil {
+		return nil, newParseError(doc, row, text, err)
+	}
+	return &results, nil
+}
+
+// rowText returns the text of s with its whitespace collapsed.
+func rowText(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
 func parseInt(s string) (int64, error) {
 	return strconv.ParseInt(s, 10, 0)
 }
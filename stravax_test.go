@@ -1,37 +1,179 @@
 package stravax
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/context"
 )
 
 var email = flag.String("email", "", "Email")
 var password = flag.String("password", "", "Password")
+var clubID = flag.Int64("club", 0, "Club ID")
 
 func TestGetLeaderboardURL(t *testing.T) {
 	tests := []struct {
 		segmentID int64
 		gender    Gender
 		filter    Filter
+		dateRange DateRange
 		expected  string
 	}{
-		{1234, Genders.Male, Filters.Overall,
+		{1234, Genders.Male, Filters.Overall, DateRanges.AllTime,
 			"https://www.strava.com/segments/1234?filter=overall&gender=M&per_page=100"},
-		{5678, Genders.Female, Filters.Overall,
+		{5678, Genders.Female, Filters.Overall, DateRanges.AllTime,
 			"https://www.strava.com/segments/5678?filter=overall&gender=F&per_page=100"},
-		{9012, Genders.Male, Filters.CurrentYear,
+		{9012, Genders.Male, Filters.CurrentYear, DateRanges.AllTime,
 			"https://www.strava.com/segments/9012?date_range=this_year&filter=current_year&gender=M&per_page=100"},
-		{3456, Genders.Female, Filters.CurrentYear,
+		{3456, Genders.Female, Filters.CurrentYear, DateRanges.AllTime,
 			"https://www.strava.com/segments/3456?date_range=this_year&filter=current_year&gender=F&per_page=100"},
+		{7890, Genders.Male, AgeGroups.Age25To34, DateRanges.AllTime,
+			"https://www.strava.com/segments/7890?age_group=25_34&filter=age_group&gender=M&per_page=100"},
+		{1357, Genders.Female, AgeGroups.Age75AndOver, DateRanges.AllTime,
+			"https://www.strava.com/segments/1357?age_group=75_plus&filter=age_group&gender=F&per_page=100"},
+		{2468, Genders.Male, WeightClasses.Kg65To74, DateRanges.AllTime,
+			"https://www.strava.com/segments/2468?filter=weight_class&gender=M&per_page=100&weight_class=65_74"},
+		{8642, Genders.Female, WeightClasses.Kg54AndUnder, DateRanges.AllTime,
+			"https://www.strava.com/segments/8642?filter=weight_class&gender=F&per_page=100&weight_class=0_54"},
+		{1234, Genders.Male, Filters.Overall, DateRanges.Today,
+			"https://www.strava.com/segments/1234?date_range=today&filter=overall&gender=M&per_page=100"},
+		{1234, Genders.Female, Filters.Overall, DateRanges.ThisWeek,
+			"https://www.strava.com/segments/1234?date_range=this_week&filter=overall&gender=F&per_page=100"},
+		{7890, Genders.Male, AgeGroups.Age45To54, DateRanges.ThisMonth,
+			"https://www.strava.com/segments/7890?age_group=45_54&date_range=this_month&filter=age_group&gender=M&per_page=100"},
+		{9012, Genders.Male, Filters.CurrentYear, DateRanges.ThisWeek,
+			"https://www.strava.com/segments/9012?date_range=this_week&filter=current_year&gender=M&per_page=100"},
+		{1234, Genders.Male, Filters.Following, DateRanges.AllTime,
+			"https://www.strava.com/segments/1234?filter=following&gender=M&per_page=100"},
+		{1234, Genders.Unspecified, myResults, DateRanges.ThisYear,
+			"https://www.strava.com/segments/1234?date_range=this_year&filter=my_results&per_page=100"},
+		{5678, Genders.Female, Club(231407), DateRanges.AllTime,
+			"https://www.strava.com/segments/5678?club_id=231407&filter=club&gender=F&per_page=100"},
 	}
 	for _, tt := range tests {
-		actual := getLeaderboardURL(tt.segmentID, tt.gender, tt.filter)
+		actual := NewStubClient().getLeaderboardURL(tt.segmentID, tt.gender, tt.filter, tt.dateRange)
 		if actual != tt.expected {
-			t.Errorf("getLeaderboardURL(%d, %s, %s): got: %s, want: %s",
-				tt.segmentID, tt.gender, tt.filter, actual, tt.expected)
+			t.Errorf("getLeaderboardURL(%d, %s, %s, %q): got: %s, want: %s",
+				tt.segmentID, tt.gender, tt.filter, tt.dateRange, actual, tt.expected)
+		}
+	}
+}
+
+func TestGetSegment(t *testing.T) {
+	expected := Segment{
+		ID:                 2198806,
+		Name:               "Hawk Hill",
+		Location:           "Sausalito, CA",
+		ActivityType:       "Run",
+		EffortCount:        3560,
+		AthleteCount:       612,
+		Distance:           1000,
+		AverageGrade:       0.05,
+		ElevationLow:       10,
+		ElevationHigh:      60,
+		TotalElevationGain: 50,
+		MedianElevation:    35,
+		StartLocation:      LatLng{37.5, -122.5},
+		EndLocation:        LatLng{37.25, -122.25},
+		Map:                "polyline",
+	}
+	now := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		token         *Token
+		unavailable   int
+		expected      error
+		apiRequests   int
+		tokenRequests int
+	}{
+		{"expired", &Token{AccessToken: "access-0", RefreshToken: "refresh-0", ExpiresAt: now}, 0, nil, 1, 1},
+		{"rejected", &Token{AccessToken: "revoked", RefreshToken: "refresh-0", ExpiresAt: now.Add(time.Hour)}, 0, nil, 2, 1},
+		{"unavailable", &Token{RefreshToken: "refresh-0"}, 1, nil, 2, 1},
+		{"revoked refresh token", &Token{RefreshToken: "revoked"}, 0, ErrAuthenticationFailed, 0, 1},
+	}
+	for _, tt := range tests {
+		tokens := newTokenServer(func() time.Time { return now })
+		// The API only accepts the access token most recently issued by tokens,
+		// after first being unavailable for tt.unavailable requests.
+		var apiRequests int
+		unavailable := tt.unavailable
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokens.mu.Lock()
+			defer tokens.mu.Unlock()
+			apiRequests++
+			if r.URL.Path != "/api/v3/segments/2198806" {
+				http.NotFound(w, r)
+				return
+			}
+			if unavailable > 0 {
+				unavailable--
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer access-"+strconv.Itoa(tokens.refreshes) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":                   2198806,
+				"name":                 "Hawk Hill",
+				"activity_type":        "Run",
+				"distance":             1000,
+				"average_grade":        5.0,
+				"elevation_low":        10,
+				"elevation_high":       60,
+				"start_latlng":         []float64{37.5, -122.5},
+				"end_latlng":           []float64{37.25, -122.25},
+				"city":                 "Sausalito",
+				"state":                "CA",
+				"total_elevation_gain": 50,
+				"map":                  map[string]string{"polyline": "polyline"},
+				"effort_count":         3560,
+				"athlete_count":        612,
+			})
+		}))
+
+		ts := NewRefreshTokenSource("id", "secret", tt.token, nil)
+		ts.TokenURL = tokens.URL + "/oauth/token"
+		ts.now = func() time.Time { return now }
+		client, err := New(context.Background(), "email", "password",
+			WithBaseURL(api.URL), WithSession(&Session{BaseURL: api.URL}), WithRateLimit(0),
+			WithRetryPolicy(RetryPolicy{Retries: 1}), WithUserAgent("test"), WithTokenSource(ts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		segment, err := client.GetSegment(expected.ID)
+		api.Close()
+		tokens.Close()
+
+		if tt.expected != nil {
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("GetSegment(%d) %s: got: %v, want: %v", expected.ID, tt.name, err, tt.expected)
+			}
+		} else if err != nil || *segment != expected {
+			t.Errorf("GetSegment(%d) %s: got: (%+v, %v), want: %+v", expected.ID, tt.name, segment, err, expected)
+		}
+		// Tokens are refreshed through the HTTP client of the Client.
+		stats := client.Stats()
+		if apiRequests != tt.apiRequests || tokens.requests != tt.tokenRequests ||
+			stats.API.Requests != int64(tt.apiRequests+tt.tokenRequests) || stats.Frontend.Requests != 0 ||
+			tokens.userAgent != "test" {
+			t.Errorf("GetSegment(%d) %s: got: (%d, %d, %+v, %s), want: (%d, %d, %s)", expected.ID, tt.name,
+				apiRequests, tokens.requests, stats, tokens.userAgent, tt.apiRequests, tt.tokenRequests, "test")
 		}
 	}
 }
@@ -41,6 +183,9 @@ func TestGetLeaderboardAndSegment(t *testing.T) {
 		ID:                 2198806,
 		Name:               "PCSD",
 		Location:           "Dixon, CA",
+		ActivityType:       "Ride",
+		EffortCount:        3560,
+		AthleteCount:       612,
 		Distance:           16110,
 		AverageGrade:       0.0008069522036002483,
 		ElevationLow:       83,
@@ -61,6 +206,9 @@ func TestGetLeaderboardAndSegment(t *testing.T) {
 		{[]string{"segment-female-overall.1.html", "segment-female-overall.2.html"}, Genders.Female, Filters.Overall, 2, 120, 120},
 		{[]string{"segment-male-yearly.1.html"}, Genders.Male, Filters.CurrentYear, 1, 21, 21},
 		{[]string{"segment-female-yearly.1.html"}, Genders.Female, Filters.CurrentYear, 1, 4, 4},
+		{[]string{"segment-male-weight.1.html"}, Genders.Male, WeightClasses.Kg65To74, 1, 12, 12},
+		{[]string{"segment-all-yearly.1.html"}, Genders.All, Filters.CurrentYear, 1, 25, 25},
+		{[]string{"segment-male-following.1.html"}, Genders.Male, Filters.Following, 1, 7, 7},
 	}
 	for _, tt := range tests {
 		client := newStubClient(t, tt.files...)
@@ -93,6 +241,9 @@ func TestGetLeaderboard(t *testing.T) {
 		{[]string{"segment-female-overall.1.html", "segment-female-overall.2.html"}, Genders.Female, Filters.Overall, 2, 120, 120},
 		{[]string{"segment-male-yearly.1.html"}, Genders.Male, Filters.CurrentYear, 1, 21, 21},
 		{[]string{"segment-female-yearly.1.html"}, Genders.Female, Filters.CurrentYear, 1, 4, 4},
+		{[]string{"segment-male-weight.1.html"}, Genders.Male, WeightClasses.Kg65To74, 1, 12, 12},
+		{[]string{"segment-all-yearly.1.html"}, Genders.All, Filters.CurrentYear, 1, 25, 25},
+		{[]string{"segment-male-following.1.html"}, Genders.Male, Filters.Following, 1, 7, 7},
 	}
 	var segmentID = int64(2198806)
 	for _, tt := range tests {
@@ -116,6 +267,9 @@ func TestGetLeaderboardPageAndSegment(t *testing.T) {
 		ID:                 2198806,
 		Name:               "PCSD",
 		Location:           "Dixon, CA",
+		ActivityType:       "Ride",
+		EffortCount:        3560,
+		AthleteCount:       612,
 		Distance:           16110,
 		AverageGrade:       0.0008069522036002483,
 		ElevationLow:       83,
@@ -136,6 +290,9 @@ func TestGetLeaderboardPageAndSegment(t *testing.T) {
 		{"segment-female-overall.2.html", Genders.Female, Filters.Overall, 2, 1, 20, 120},
 		{"segment-male-yearly.1.html", Genders.Male, Filters.CurrentYear, 1, 1, 21, 21},
 		{"segment-female-yearly.1.html", Genders.Female, Filters.CurrentYear, 1, 1, 4, 4},
+		{"segment-male-weight.1.html", Genders.Male, WeightClasses.Kg65To74, 1, 1, 12, 12},
+		{"segment-all-yearly.1.html", Genders.All, Filters.CurrentYear, 1, 1, 25, 25},
+		{"segment-male-following.1.html", Genders.Male, Filters.Following, 1, 1, 7, 7},
 	}
 	for _, tt := range tests {
 		client := newStubClient(t, tt.file)
@@ -168,6 +325,9 @@ func TestGetLeaderboardPage(t *testing.T) {
 		{"segment-female-overall.2.html", Genders.Female, Filters.Overall, 2, 1, 20, 120},
 		{"segment-male-yearly.1.html", Genders.Male, Filters.CurrentYear, 1, 1, 21, 21},
 		{"segment-female-yearly.1.html", Genders.Female, Filters.CurrentYear, 1, 1, 4, 4},
+		{"segment-male-weight.1.html", Genders.Male, WeightClasses.Kg65To74, 1, 1, 12, 12},
+		{"segment-all-yearly.1.html", Genders.All, Filters.CurrentYear, 1, 1, 25, 25},
+		{"segment-male-following.1.html", Genders.Male, Filters.Following, 1, 1, 7, 7},
 	}
 	var segmentID = int64(2198806)
 	for _, tt := range tests {
@@ -186,6 +346,649 @@ func TestGetLeaderboardPage(t *testing.T) {
 	}
 }
 
+func TestGetClubLeaderboard(t *testing.T) {
+	var segmentID, clubID = int64(2198806), int64(231407)
+	client := newStubClient(t, "segment-male-club.1.html")
+	leaderboard, err := client.GetClubLeaderboard(segmentID, clubID, Genders.Male)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard.Entries) != 9 || leaderboard.EntriesCount != 9 || client.RequestCount != 1 {
+		t.Errorf("GetClubLeaderboard(%d, %d, %s): got: ((%d, %d), %d), want: ((%d, %d), %d)",
+			segmentID, clubID, Genders.Male, len(leaderboard.Entries), leaderboard.EntriesCount,
+			client.RequestCount, 9, 9, 1)
+	}
+}
+
+func TestGetClubLeaderboardPage(t *testing.T) {
+	var segmentID, clubID = int64(2198806), int64(231407)
+	client := newStubClient(t, "segment-male-club.1.html")
+	leaderboard, err := client.GetClubLeaderboardPage(segmentID, clubID, Genders.Male, 1, DateRanges.ThisMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard.Entries) != 9 || leaderboard.EntriesCount != 9 || client.RequestCount != 1 {
+		t.Errorf("GetClubLeaderboardPage(%d, %d, %s, %d): got: ((%d, %d), %d), want: ((%d, %d), %d)",
+			segmentID, clubID, Genders.Male, 1, len(leaderboard.Entries), leaderboard.EntriesCount,
+			client.RequestCount, 9, 9, 1)
+	}
+}
+
+func TestGetRecordsAndSegment(t *testing.T) {
+	var segmentID = int64(2198806)
+	expected := Records{
+		Men: &Record{
+			Athlete: Athlete{
+				Name:       "Dave Bailey",
+				Gender:     Genders.Male,
+				AvatarURL:  "https://dgalywyr863hv.cloudfront.net/pictures/athletes/143982/127671/1/medium.jpg",
+				Subscriber: true,
+			},
+			EffortID:    1440115807,
+			StartDate:   time.Date(2013, time.August, 7, 0, 0, 0, 0, time.UTC),
+			ElapsedTime: 1176,
+		},
+		Women: &Record{
+			Athlete: Athlete{
+				Name:      "Alison Tetrick",
+				Gender:    Genders.Female,
+				AvatarURL: "https://dgalywyr863hv.cloudfront.net/pictures/athletes/188112/45714/7/medium.jpg",
+			},
+			EffortID:    356621090,
+			StartDate:   time.Date(2012, time.August, 15, 0, 0, 0, 0, time.UTC),
+			ElapsedTime: 1282,
+		},
+	}
+	client := newStubClient(t, "segment-male-overall.1.html")
+	records, segment, err := client.GetRecordsAndSegment(segmentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records.Men == nil || *records.Men != *expected.Men ||
+		records.Women == nil || *records.Women != *expected.Women ||
+		records.PR != nil || segment.ID != segmentID || client.RequestCount != 1 {
+		t.Errorf("GetRecordsAndSegment(%d): got: ((%v, %v, %v), %d, %d), want: ((%v, %v, %v), %d, %d)",
+			segmentID, records.Men, records.Women, records.PR, segment.ID, client.RequestCount,
+			expected.Men, expected.Women, expected.PR, segmentID, 1)
+	}
+}
+
+func TestParseRecords(t *testing.T) {
+	result := func(label, name, elapsed string, effortID int64) string {
+		return fmt.Sprintf("<div class='results'><div class='result'><div class='athlete'>%s</div>"+
+			"<strong>%s</strong>\n%s\n<span class='timestamp'><a href=\"/segment_efforts/%d\">Jun 1, 2018</a></span>"+
+			"</div></div>", name, label, elapsed, effortID)
+	}
+	html := "<div class='kom-qom'>" +
+		result("CR", "Runner M", "5:01", 1) +
+		result("CR", "Runner F", "5:42", 2) +
+		result("PR", "Me", "7:15", 3) +
+		"</div>"
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := parseRecords(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records.Men == nil || records.Men.Athlete.Name != "Runner M" || records.Men.ElapsedTime != 301 ||
+		records.Women == nil || records.Women.Athlete.Name != "Runner F" || records.Women.ElapsedTime != 342 ||
+		records.PR == nil || records.PR.EffortID != 3 || records.PR.ElapsedTime != 435 {
+		t.Errorf("parseRecords: got: (%v, %v, %v)", records.Men, records.Women, records.PR)
+	}
+}
+
+func TestGetMyResults(t *testing.T) {
+	var segmentID = int64(2198806)
+	client := newStubClient(t, "segment-my-results.1.html")
+	results, err := client.GetMyResults(segmentID, DateRanges.ThisYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFirst := Effort{
+		EffortID:    39842771021,
+		StartDate:   time.Date(2018, time.May, 12, 0, 0, 0, 0, time.UTC),
+		ElapsedTime: 1712,
+	}
+	if len(results.Efforts) != 6 || *results.Efforts[0] != expectedFirst || client.RequestCount != 1 {
+		t.Errorf("GetMyResults(%d, %s): got: (%d, %v, %d), want: (%d, %v, %d)",
+			segmentID, DateRanges.ThisYear, len(results.Efforts), *results.Efforts[0], client.RequestCount,
+			6, expectedFirst, 1)
+	}
+}
+
+func TestGetLeaderboardEntryColumns(t *testing.T) {
+	var segmentID = int64(2198806)
+	client := newStubClient(t, "segment-female-yearly.1.html")
+	leaderboard, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		averageSpeed     float64
+		averageHeartrate float64
+		averageWatts     float64
+		deviceWatts      bool
+		vam              float64
+	}{
+		{38.4 * units["kilometers per hour"], 144, 231, false, 0},
+		{35.6 * units["kilometers per hour"], 158, 213, true, 0},
+		{34.1 * units["kilometers per hour"], 0, 168, false, 0},
+		{31.3 * units["kilometers per hour"], 191, 173, true, 0},
+	}
+	for i, tt := range tests {
+		e := leaderboard.Entries[i]
+		if e.AverageSpeed != tt.averageSpeed ||
+			e.AverageHeartrate != tt.averageHeartrate ||
+			e.AverageWatts != tt.averageWatts ||
+			e.DeviceWatts != tt.deviceWatts ||
+			e.VAM != tt.vam {
+			t.Errorf("entry %d: got: (%v, %v, %v, %t, %v), want: (%v, %v, %v, %t, %v)", i,
+				e.AverageSpeed, e.AverageHeartrate, e.AverageWatts, e.DeviceWatts, e.VAM,
+				tt.averageSpeed, tt.averageHeartrate, tt.averageWatts, tt.deviceWatts, tt.vam)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		html     string
+		expected float64
+	}{
+		{"<td>38.4<abbr class='unit' title='kilometers per hour'>km/h</abbr></td>", 38.4 * 1000 / 3600},
+		{"<td>23.9<abbr class='unit' title='miles per hour'>mi/h</abbr></td>", 23.9 * 1609.344 / 3600},
+		{"<td>16.11<abbr class='unit' title='kilometers'>km</abbr></td>", 16110},
+		{"<td>10.0<abbr class='unit' title='miles'>mi</abbr></td>", 16093.44},
+		{"<td>1,024<abbr class='unit' title='feet'>ft</abbr></td>", 312.1152},
+		{"<td>4.5<abbr class='unit' title='percent'>%</abbr></td>", 0.045},
+		{"<td>\n144<abbr class='unit' title='beats per minute'>bpm</abbr>\n</td>", 144},
+		{"<td class='power text-nowrap'>\n213<abbr class='unit' title='watts'>W</abbr>\n" +
+			"<img class=\"power-meter\" alt=\"Powermeter\" />\n</td>", 213},
+		{"<td>\n1,234<abbr class='unit' title='meters per hour'>Vm/h</abbr>\n</td>", 1234},
+		{"<td>\n4,048<abbr class='unit' title='feet per hour'>VAM</abbr>\n</td>", 1233.8304},
+		{"<td>\n-\n</td>", 0},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(
+			strings.NewReader("<table><tr>" + tt.html + "</tr></table>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := parseValue(doc.Find("td"))
+		if err != nil || !approx(actual, tt.expected) {
+			t.Errorf("parseValue(%q): got: (%v, %v), want: (%v, %v)", tt.html, actual, err, tt.expected, nil)
+		}
+	}
+}
+
+func TestGetLeaderboardPageAndSegmentImperial(t *testing.T) {
+	expectedSegment := Segment{
+		ID:                 2198806,
+		Name:               "PCSD",
+		Location:           "Dixon, CA",
+		ActivityType:       "Ride",
+		EffortCount:        3560,
+		AthleteCount:       612,
+		Distance:           16093.44,
+		AverageGrade:       0.0008143939393939394,
+		ElevationLow:       82.9056,
+		ElevationHigh:      96.012,
+		TotalElevationGain: 13.1064,
+		MedianElevation:    89.4588,
+	}
+	client := newStubClient(t, "segment-male-yearly.imperial.1.html")
+	leaderboard, segment, err :=
+		client.GetLeaderboardPageAndSegment(expectedSegment.ID, Genders.Male, Filters.CurrentYear, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segment.ActivityType != expectedSegment.ActivityType ||
+		segment.EffortCount != expectedSegment.EffortCount ||
+		segment.AthleteCount != expectedSegment.AthleteCount ||
+		!approx(segment.Distance, expectedSegment.Distance) ||
+		!approx(segment.AverageGrade, expectedSegment.AverageGrade) ||
+		!approx(segment.ElevationLow, expectedSegment.ElevationLow) ||
+		!approx(segment.ElevationHigh, expectedSegment.ElevationHigh) ||
+		!approx(segment.TotalElevationGain, expectedSegment.TotalElevationGain) ||
+		!approx(segment.MedianElevation, expectedSegment.MedianElevation) {
+		t.Errorf("GetLeaderboardPageAndSegment(%d, %s, %s, %d): got: %v, want: %v",
+			expectedSegment.ID, Genders.Male, Filters.CurrentYear, 1, *segment, expectedSegment)
+	}
+	expectedSpeed := 27.9 * 1609.344 / 3600
+	if len(leaderboard.Entries) != 21 || !approx(leaderboard.Entries[0].AverageSpeed, expectedSpeed) {
+		t.Errorf("GetLeaderboardPageAndSegment(%d, %s, %s, %d): got: (%d, %v), want: (%d, %v)",
+			expectedSegment.ID, Genders.Male, Filters.CurrentYear, 1,
+			len(leaderboard.Entries), leaderboard.Entries[0].AverageSpeed, 21, expectedSpeed)
+	}
+}
+
+func TestGetLeaderboardPageAndSegmentRun(t *testing.T) {
+	var segmentID = int64(2198806)
+	client := newStubClient(t, "segment-female-run.1.html")
+	leaderboard, segment, err :=
+		client.GetLeaderboardPageAndSegment(segmentID, Genders.Female, Filters.CurrentYear, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segment.ActivityType != "Run" || len(leaderboard.Entries) != 4 {
+		t.Errorf("GetLeaderboardPageAndSegment(%d, %s, %s, %d): got: (%s, %d), want: (%s, %d)",
+			segmentID, Genders.Female, Filters.CurrentYear, 1, segment.ActivityType, len(leaderboard.Entries), "Run", 4)
+	}
+	// Runs display pace instead of speed, and no power.
+	expected := LeaderboardEntry{AverageHeartrate: 144, VAM: 1234, ElapsedTime: 1510}
+	e := leaderboard.Entries[0]
+	if e.AverageSpeed != expected.AverageSpeed ||
+		e.AverageHeartrate != expected.AverageHeartrate ||
+		e.AverageWatts != expected.AverageWatts ||
+		e.VAM != expected.VAM ||
+		e.ElapsedTime != expected.ElapsedTime {
+		t.Errorf("entry 0: got: (%v, %v, %v, %v, %d), want: (%v, %v, %v, %v, %d)",
+			e.AverageSpeed, e.AverageHeartrate, e.AverageWatts, e.VAM, e.ElapsedTime,
+			expected.AverageSpeed, expected.AverageHeartrate, expected.AverageWatts, expected.VAM, expected.ElapsedTime)
+	}
+}
+
+func TestGetLeaderboardPageAndSegmentAttempts(t *testing.T) {
+	var segmentID = int64(2198806)
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "segment-female-yearly.1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := `<li><div class="stat attempts"><span class="stat-subtext">3,560 Attempts By 612 People</span>` +
+		`<b class="stat-text"></b></div></li>`
+	tests := []struct {
+		replacement string
+		expectedErr bool
+	}{
+		// The counts are optional, but must be parsed if they are displayed.
+		{"", false},
+		{strings.Replace(attempts, "3,560", "many", 1), true},
+	}
+	for _, tt := range tests {
+		page := strings.Replace(string(content), attempts, tt.replacement, 1)
+		_, segment, err := NewStubClient(page).GetLeaderboardPageAndSegment(segmentID, Genders.Female, Filters.CurrentYear, 1)
+		if tt.expectedErr {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("GetLeaderboardPageAndSegment(%d, %s, %s, %d) with %q: got: %v, want: *ParseError",
+					segmentID, Genders.Female, Filters.CurrentYear, 1, tt.replacement, err)
+			}
+		} else if err != nil || segment.EffortCount != 0 || segment.AthleteCount != 0 || segment.Distance == 0 {
+			t.Errorf("GetLeaderboardPageAndSegment(%d, %s, %s, %d) with %q: got: (%+v, %v), want: no counts",
+				segmentID, Genders.Female, Filters.CurrentYear, 1, tt.replacement, segment, err)
+		}
+	}
+}
+
+func TestGetLeaderboardViewer(t *testing.T) {
+	tests := []struct {
+		file     string
+		gender   Gender
+		filter   Filter
+		expected *Standing
+	}{
+		{"segment-male-yearly.1.html", Genders.Male, Filters.CurrentYear, nil},
+		// Hand-made, as the athlete the golden fixtures are saved by has no effort.
+		{"segment-male-following.viewer.1.html", Genders.Male, Filters.Following, &Standing{5, 1352}},
+	}
+	var segmentID = int64(2198806)
+	for _, tt := range tests {
+		client := newStubClient(t, tt.file)
+		leaderboard, err := client.GetLeaderboard(segmentID, tt.gender, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (leaderboard.Viewer == nil) != (tt.expected == nil) ||
+			(tt.expected != nil && *leaderboard.Viewer != *tt.expected) {
+			t.Errorf("GetLeaderboard(%d, %s, %s): got: %v, want: %v",
+				segmentID, tt.gender, tt.filter, leaderboard.Viewer, tt.expected)
+		}
+	}
+}
+
+func TestGetLeaderboardAthlete(t *testing.T) {
+	tests := []struct {
+		file     string
+		gender   Gender
+		filter   Filter
+		expected map[int]Athlete
+	}{
+		{"segment-male-overall.1.html", Genders.Male, Filters.Overall, map[int]Athlete{
+			0: {143982, "https://www.strava.com/athletes/143982", "Dave Bailey", Genders.Male,
+				"https://dgalywyr863hv.cloudfront.net/pictures/athletes/143982/127671/1/medium.jpg", true},
+			1: {46792, "https://www.strava.com/athletes/46792", "Chris Lyman", Genders.Male, "", false},
+			7: {0, "https://www.strava.com/pros/cstastny", "Chris Stastny", Genders.Male, "", false},
+		}},
+		{"segment-female-yearly.1.html", Genders.Female, Filters.CurrentYear, map[int]Athlete{
+			0: {18521592, "https://www.strava.com/athletes/18521592", "Claudia Ferreira", Genders.Female,
+				"https://dgalywyr863hv.cloudfront.net/pictures/athletes/18521592/5274764/1/medium.jpg", false},
+			1: {6199157, "https://www.strava.com/athletes/6199157", "Cary Craig", Genders.Female, "", false},
+		}},
+	}
+	var segmentID = int64(2198806)
+	for _, tt := range tests {
+		client := newStubClient(t, tt.file)
+		leaderboard, err := client.GetLeaderboardPage(segmentID, tt.gender, tt.filter, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range tt.expected {
+			if actual := leaderboard.Entries[i].Athlete; actual != expected {
+				t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): entry %d: got: %v, want: %v",
+					segmentID, tt.gender, tt.filter, 1, i, actual, expected)
+			}
+		}
+	}
+}
+
+func TestGetLeaderboardAthleteGender(t *testing.T) {
+	tests := []struct {
+		file     string
+		gender   Gender
+		expected Gender
+	}{
+		{"segment-male-yearly.1.html", Genders.Male, Genders.Male},
+		{"segment-female-yearly.1.html", Genders.Female, Genders.Female},
+		{"segment-all-yearly.1.html", Genders.All, Genders.Unspecified},
+	}
+	var segmentID = int64(2198806)
+	for _, tt := range tests {
+		client := newStubClient(t, tt.file)
+		leaderboard, err := client.GetLeaderboard(segmentID, tt.gender, Filters.CurrentYear)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range leaderboard.Entries {
+			if e.Athlete.Gender != tt.expected {
+				t.Errorf("GetLeaderboard(%d, %s, %s): got: %q for %s, want: %q",
+					segmentID, tt.gender, Filters.CurrentYear, e.Athlete.Gender, e.Athlete.Name, tt.expected)
+			}
+		}
+	}
+}
+
+func TestGetLeaderboardContext(t *testing.T) {
+	var segmentID = int64(2198806)
+	files := []string{"segment-male-overall.1.html", "segment-male-overall.2.html", "segment-male-overall.3.html",
+		"segment-male-overall.4.html", "segment-male-overall.5.html"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := newStubClient(t, files...)
+	_, err := client.GetLeaderboardContext(ctx, segmentID, Genders.Male, Filters.Overall)
+	if err != context.Canceled || client.RequestCount != 0 {
+		t.Errorf("GetLeaderboardContext(%d, %s, %s): got: (%v, %d), want: (%v, %d)",
+			segmentID, Genders.Male, Filters.Overall, err, client.RequestCount, context.Canceled, 0)
+	}
+
+	// Cancelling part way through stops any further pages from being fetched.
+	ctx, cancel = context.WithCancel(context.Background())
+	client = newStubClient(t, files...)
+	client.httpClient.Transport = &cancelTransport{client.httpClient.Transport, cancel, 2}
+	_, err = client.GetLeaderboardContext(ctx, segmentID, Genders.Male, Filters.Overall)
+	if err != context.Canceled || client.RequestCount != 2 {
+		t.Errorf("GetLeaderboardContext(%d, %s, %s): got: (%v, %d), want: (%v, %d)",
+			segmentID, Genders.Male, Filters.Overall, err, client.RequestCount, context.Canceled, 2)
+	}
+
+	// A throttled request returns as soon as the context is done.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client = newStubClient(t, files...)
+	client.limiter = NewLimiter(0, 1, Budget{0, time.Hour})
+	_, err = client.GetLeaderboardPageContext(ctx, segmentID, Genders.Male, Filters.Overall, 1)
+	if err != context.DeadlineExceeded || client.RequestCount != 0 {
+		t.Errorf("GetLeaderboardPageContext(%d, %s, %s, %d): got: (%v, %d), want: (%v, %d)",
+			segmentID, Genders.Male, Filters.Overall, 1, err, client.RequestCount, context.DeadlineExceeded, 0)
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	var segmentID = int64(2198806)
+	const n = 8
+	var files []string
+	for i := 0; i < n; i++ {
+		files = append(files, "segment-female-yearly.1.html")
+	}
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "segment-female-yearly.1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newStubClient(t, files...)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leaderboard, err := client.GetLeaderboardPage(segmentID, Genders.Female, Filters.CurrentYear, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(leaderboard.Entries) != 4 {
+				t.Errorf("GetLeaderboardPage(%d, %s, %s, %d): got: %d, want: %d",
+					segmentID, Genders.Female, Filters.CurrentYear, 1, len(leaderboard.Entries), 4)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := client.Stats()
+	if client.RequestCount != n ||
+		stats.Frontend.Requests != n ||
+		stats.Frontend.StatusCodes[200] != n ||
+		stats.Frontend.BytesReceived != n*int64(len(content)) ||
+		stats.API.Requests != 0 {
+		t.Errorf("concurrent GetLeaderboardPage: got: (%d, %d, %d, %d, %d), want: (%d, %d, %d, %d, %d)",
+			client.RequestCount, stats.Frontend.Requests, stats.Frontend.StatusCodes[200],
+			stats.Frontend.BytesReceived, stats.API.Requests, n, n, n, n*len(content), 0)
+	}
+}
+
+func TestGetLeaderboardConcurrent(t *testing.T) {
+	var segmentID = int64(2198806)
+	files := []string{"segment-male-overall.1.html", "segment-male-overall.2.html", "segment-male-overall.3.html", "segment-male-overall.4.html", "segment-male-overall.5.html"}
+
+	expected, err := newStubClient(t, files...).GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newStubClient(t)
+	client.httpClient.Transport.(*transport).base = newPageTransport(t, files...)
+	client.concurrency = 3
+	leaderboard, err := client.GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard.Entries) != len(expected.Entries) ||
+		leaderboard.EntriesCount != expected.EntriesCount ||
+		leaderboard.Shifted ||
+		client.RequestCount != 5 {
+		t.Errorf("GetLeaderboard(%d, %s, %s): got: ((%d, %d, %t), %d), want: ((%d, %d, %t), %d)",
+			segmentID, Genders.Male, Filters.Overall, len(leaderboard.Entries), leaderboard.EntriesCount,
+			leaderboard.Shifted, client.RequestCount, len(expected.Entries), expected.EntriesCount, false, 5)
+	}
+	for i, entry := range leaderboard.Entries {
+		if i < len(expected.Entries) && *entry != *expected.Entries[i] {
+			t.Errorf("GetLeaderboard(%d, %s, %s).Entries[%d]: got: %+v, want: %+v",
+				segmentID, Genders.Male, Filters.Overall, i, entry, expected.Entries[i])
+		}
+	}
+
+	// A page from a leaderboard with a different number of entries is a shift.
+	shifted := append([]string{}, files...)
+	shifted[2] = "segment-female-overall.2.html"
+	client = newStubClient(t)
+	client.httpClient.Transport.(*transport).base = newPageTransport(t, shifted...)
+	client.concurrency = 3
+	leaderboard, err = client.GetLeaderboard(segmentID, Genders.Male, Filters.Overall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !leaderboard.Shifted {
+		t.Errorf("GetLeaderboard(%d, %s, %s).Shifted: got: %t, want: %t",
+			segmentID, Genders.Male, Filters.Overall, leaderboard.Shifted, true)
+	}
+
+	// An error fetching any page is returned.
+	client = newStubClient(t)
+	client.httpClient.Transport.(*transport).base = newPageTransport(t, files[:3]...)
+	client.concurrency = 3
+	if _, err = client.GetLeaderboard(segmentID, Genders.Male, Filters.Overall); err == nil {
+		t.Errorf("GetLeaderboard(%d, %s, %s): got: %v, want: error",
+			segmentID, Genders.Male, Filters.Overall, err)
+	}
+}
+
+func TestGetLeaderboardReconcile(t *testing.T) {
+	var segmentID = int64(2198806)
+	// An effort is uploaded to the top of the leaderboard after the first page
+	// is fetched, pushing the last entry of the first page onto the second, or
+	// an effort on the first page is deleted, pulling the first entry of the
+	// second page onto the first.
+	tests := []struct {
+		files                []string
+		refetches            int
+		expectedRequestCount int64
+		expectedLenEntries   int
+		expectedDuplicates   int
+		expectedConsistent   bool
+	}{
+		{[]string{"segment-female-overall.1.html", "segment-female-overall.2.html"}, 1, 2, 120, 0, true},
+		{[]string{"segment-female-overall.1.html", "segment-female-overall.shifted.2.html"}, 0, 2, 120, 1, false},
+		{[]string{"segment-female-overall.1.html", "segment-female-overall.shifted.2.html", "segment-female-overall.shifted.1.html"}, 1, 3, 121, 0, true},
+		{[]string{"segment-female-overall.1.html", "segment-female-overall.deleted.2.html"}, 0, 2, 119, 0, false},
+		{[]string{"segment-female-overall.1.html", "segment-female-overall.deleted.2.html", "segment-female-overall.deleted.1.html"}, 5, 3, 119, 0, true},
+	}
+	for _, tt := range tests {
+		client := newStubClient(t, tt.files...)
+		client.refetches = tt.refetches
+		leaderboard, err := client.GetLeaderboard(segmentID, Genders.Female, Filters.Overall)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leaderboard.Entries) != tt.expectedLenEntries ||
+			leaderboard.Duplicates != tt.expectedDuplicates ||
+			leaderboard.Consistent() != tt.expectedConsistent ||
+			client.RequestCount != tt.expectedRequestCount {
+			t.Errorf("GetLeaderboard(%d, %s, %s) with %d refetches: got: ((%d, %d, %t), %d), want: ((%d, %d, %t), %d)",
+				segmentID, Genders.Female, Filters.Overall, tt.refetches, len(leaderboard.Entries), leaderboard.Duplicates,
+				leaderboard.Consistent(), client.RequestCount, tt.expectedLenEntries, tt.expectedDuplicates,
+				tt.expectedConsistent, tt.expectedRequestCount)
+		}
+	}
+
+	// The first of 8 efforts is deleted after the first two pages of 2 entries
+	// are fetched. Re-fetching the second page pulls the third effort onto it,
+	// after which the first page must be re-fetched as well.
+	before := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	after := before[1:]
+	pages := []string{
+		leaderboardPage(before, 1, 2), leaderboardPage(before, 2, 2),
+		leaderboardPage(after, 3, 2), leaderboardPage(after, 4, 2),
+		leaderboardPage(after, 2, 2), leaderboardPage(after, 1, 2),
+	}
+	deletedTests := []struct {
+		refetches            int
+		expectedRequestCount int64
+		expectedEfforts      []int64
+		expectedConsistent   bool
+	}{
+		{0, 4, []int64{1, 2, 3, 4, 6, 7, 8}, false},
+		{1, 5, []int64{1, 2, 4, 5, 6, 7, 8}, false},
+		{5, 6, []int64{2, 3, 4, 5, 6, 7, 8}, true},
+	}
+	for _, tt := range deletedTests {
+		client := NewStubClient(pages...)
+		client.pageSize = 2
+		client.refetches = tt.refetches
+		leaderboard, err := client.GetLeaderboard(segmentID, Genders.Female, Filters.Overall)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var efforts []int64
+		for _, entry := range leaderboard.Entries {
+			efforts = append(efforts, entry.EffortID)
+		}
+		if fmt.Sprint(efforts) != fmt.Sprint(tt.expectedEfforts) ||
+			leaderboard.Consistent() != tt.expectedConsistent ||
+			client.RequestCount != tt.expectedRequestCount {
+			t.Errorf("GetLeaderboard(%d, %s, %s) with %d refetches: got: ((%v, %t), %d), want: ((%v, %t), %d)",
+				segmentID, Genders.Female, Filters.Overall, tt.refetches, efforts, leaderboard.Consistent(),
+				client.RequestCount, tt.expectedEfforts, tt.expectedConsistent, tt.expectedRequestCount)
+		}
+	}
+}
+
+// leaderboardPage returns the specified page of a leaderboard of efforts ranked
+// in order with pageSize entries per page, as the frontend displays it.
+func leaderboardPage(efforts []int64, page, pageSize int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<table><tr><td class='standing'><strong>- / %d</strong></td></tr></table>", len(efforts))
+	b.WriteString("<table class='table-leaderboard'><thead><tr><th>Rank</th><th>Name</th><th>Date</th>" +
+		"<th>Time</th></tr></thead><tbody>")
+	for i := (page - 1) * pageSize; i < page*pageSize && i < len(efforts); i++ {
+		fmt.Fprintf(&b, "<tr><td>%d</td><td><a href='/athletes/%d'>Athlete %d</a></td>"+
+			"<td><a href='/segment_efforts/%d'>Jun 12, 2018</a></td><td>%d:00</td></tr>",
+			i+1, efforts[i], efforts[i], efforts[i], 10+i)
+	}
+	b.WriteString("</tbody></table>")
+	if page*pageSize < len(efforts) {
+		b.WriteString("<ul class='pagination'><li class='active'>1</li><li>2</li><li class='next_page'>Next</li></ul>")
+	}
+	return b.String()
+}
+
+// pageTransport responds to each request with the file for its page parameter.
+type pageTransport struct {
+	pages []string
+}
+
+func newPageTransport(t *testing.T, files ...string) *pageTransport {
+	var pages []string
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, string(content))
+	}
+	return &pageTransport{pages}
+}
+
+func (t *pageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	page, err := strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil {
+		page = 1
+	}
+	if page < 1 || page > len(t.pages) {
+		return nil, fmt.Errorf("request for stub page %d but only %d exist", page, len(t.pages))
+	}
+	return &http.Response{
+		Status:     http.StatusText(200),
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(t.pages[page-1])),
+		Request:    req,
+	}, nil
+}
+
+// cancelTransport calls cancel after n requests have been made.
+type cancelTransport struct {
+	http.RoundTripper
+	cancel func()
+	n      int
+}
+
+func (t *cancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.n--
+	if t.n == 0 {
+		t.cancel()
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
 func TestUpdateGolden(t *testing.T) {
 	if *email == "" || *password == "" {
 		return
@@ -195,19 +998,27 @@ func TestUpdateGolden(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	fixtures := []struct {
+	type fixture struct {
 		prefix   string
 		gender   Gender
 		filter   Filter
 		requests int
-	}{
+	}
+	fixtures := []fixture{
 		{"segment-male-overall", Genders.Male, Filters.Overall, 5},
 		{"segment-female-overall", Genders.Female, Filters.Overall, 2},
 		{"segment-male-yearly", Genders.Male, Filters.CurrentYear, 1},
 		{"segment-female-yearly", Genders.Female, Filters.CurrentYear, 1},
+		{"segment-male-weight", Genders.Male, WeightClasses.Kg65To74, 1},
+		{"segment-all-yearly", Genders.All, Filters.CurrentYear, 1},
+		{"segment-male-following", Genders.Male, Filters.Following, 1},
+		{"segment-my-results", Genders.Unspecified, myResults, 1},
+	}
+	if *clubID != 0 {
+		fixtures = append(fixtures, fixture{"segment-male-club", Genders.Male, Club(*clubID), 1})
 	}
 	for _, fix := range fixtures {
-		url := getLeaderboardURL(2198806, fix.gender, fix.filter)
+		url := client.getLeaderboardURL(2198806, fix.gender, fix.filter, DateRanges.AllTime)
 		for i := 0; i < fix.requests; i++ {
 			resp, err := client.httpClient.Get(fmt.Sprintf("%s&page=%d", url, i+1))
 			if err != nil {
@@ -229,6 +1040,10 @@ func TestUpdateGolden(t *testing.T) {
 
 }
 
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
 func newStubClient(t *testing.T, files ...string) *Client {
 	var contents []string
 	for _, file := range files {
@@ -0,0 +1,200 @@
+package stravax
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TOKEN_URL is the URL of the Strava OAuth2 token endpoint.
+const TOKEN_URL = "https://www.strava.com/oauth/token"
+
+// tokenExpiryDelta is how long before a Token expires that it is refreshed, to
+// allow for clock skew and the time taken by the request it is used for.
+const tokenExpiryDelta = time.Minute
+
+// Token is an OAuth2 token for the Strava API. ExpiresAt is the zero time if
+// the AccessToken is not known to expire.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// valid returns whether t may still be used at now.
+func (t *Token) valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" &&
+		(t.ExpiresAt.IsZero() || now.Add(tokenExpiryDelta).Before(t.ExpiresAt))
+}
+
+// TokenSource supplies the access tokens a Client uses to authenticate requests
+// made against the Strava API. Implementations must be safe for concurrent use.
+type TokenSource interface {
+	// Token returns a Token which is valid for use, refreshing it if necessary.
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenInvalidator may optionally be implemented by a TokenSource so that a
+// Client can tell it when Strava rejects an access token before it would
+// otherwise expire (eg. because it was revoked). The Client retries the request
+// once with the Token returned next.
+type TokenInvalidator interface {
+	// Invalidate makes the next call to Token return a different Token if the
+	// current AccessToken is still accessToken.
+	Invalidate(accessToken string)
+}
+
+// httpClientKey is the context key under which a Client passes its HTTP client
+// to the TokenSource it uses.
+type httpClientKey struct{}
+
+// staticTokenSource always returns the same Token.
+type staticTokenSource struct {
+	token *Token
+}
+
+func (s staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	return s.token, nil
+}
+
+// RefreshTokenSource is a TokenSource which refreshes its Token using the OAuth2
+// refresh token flow once it has expired, or once Strava has rejected it.
+type RefreshTokenSource struct {
+	// ClientID and ClientSecret identify the Strava API application.
+	ClientID     string
+	ClientSecret string
+	// TokenURL is the token endpoint to refresh tokens with, TOKEN_URL if empty.
+	TokenURL string
+	// HTTPClient is used to make refresh requests. If nil, the HTTP client of
+	// the Client using the RefreshTokenSource is used (so that its transport,
+	// user agent and Stats apply), or a client with TIMEOUT outside of a Client.
+	HTTPClient *http.Client
+	// OnRefresh, if not nil, is called with each refreshed Token before it is
+	// used. Strava rotates refresh tokens, so the Token should be persisted for
+	// subsequent runs. An error from OnRefresh is returned by Token, but the
+	// refreshed Token is still kept, as the previous refresh token may no
+	// longer be valid.
+	OnRefresh func(*Token) error
+
+	mu    sync.Mutex
+	token *Token
+	now   func() time.Time
+}
+
+// NewRefreshTokenSource returns a RefreshTokenSource for the application
+// identified by clientID and clientSecret which starts from token. token may
+// have only its RefreshToken set, in which case it is refreshed on first use.
+func NewRefreshTokenSource(clientID, clientSecret string, token *Token, onRefresh func(*Token) error) *RefreshTokenSource {
+	return &RefreshTokenSource{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		OnRefresh:    onRefresh,
+		token:        token,
+	}
+}
+
+// Token returns the current Token, refreshing it first if it has expired.
+func (s *RefreshTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	if s.token.valid(now()) {
+		return s.token, nil
+	}
+	token, err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	if s.OnRefresh != nil {
+		if err := s.OnRefresh(token); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// Invalidate makes the next call to Token refresh the current Token if its
+// AccessToken is still accessToken, because Strava has rejected it.
+func (s *RefreshTokenSource) Invalidate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && s.token.AccessToken == accessToken {
+		token := *s.token
+		token.AccessToken = ""
+		s.token = &token
+	}
+}
+
+func (s *RefreshTokenSource) refresh(ctx context.Context) (*Token, error) {
+	if s.token == nil || s.token.RefreshToken == "" {
+		return nil, ErrAuthenticationFailed
+	}
+	tokenURL := s.TokenURL
+	if tokenURL == "" {
+		tokenURL = TOKEN_URL
+	}
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient, _ = ctx.Value(httpClientKey{}).(*http.Client)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: TIMEOUT}
+	}
+
+	form := url.Values{
+		"client_id":     {s.ClientID},
+		"client_secret": {s.ClientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.token.RefreshToken}}
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	// Strava responds with 400 Bad Request to an invalid refresh token.
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return nil, &TokenError{URL: tokenURL, StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(tokenURL, resp)
+	}
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresAt    int64  `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in response from %s", tokenURL)
+	}
+
+	token := &Token{AccessToken: body.AccessToken, RefreshToken: body.RefreshToken}
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.token.RefreshToken
+	}
+	if body.ExpiresAt != 0 {
+		token.ExpiresAt = time.Unix(body.ExpiresAt, 0)
+	}
+	return token, nil
+}
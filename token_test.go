@@ -0,0 +1,153 @@
+package stravax
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// tokenServer is a Strava token endpoint which rotates the refresh token each
+// time it is used, and issues access tokens which expire six hours after now.
+type tokenServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	requests  int
+	userAgent string
+	refreshes int
+	refresh   string
+}
+
+func newTokenServer(now func() time.Time) *tokenServer {
+	s := &tokenServer{refresh: "refresh-0"}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		s.userAgent = r.UserAgent()
+		if r.FormValue("client_id") != "id" || r.FormValue("client_secret") != "secret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != s.refresh {
+			http.Error(w, "invalid refresh token", http.StatusBadRequest)
+			return
+		}
+		s.refreshes++
+		s.refresh = "refresh-" + strconv.Itoa(s.refreshes)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-" + strconv.Itoa(s.refreshes),
+			"refresh_token": s.refresh,
+			"expires_at":    now().Add(6 * time.Hour).Unix(),
+		})
+	}))
+	return s
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	now := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	server := newTokenServer(func() time.Time { return now })
+	defer server.Close()
+
+	var persisted []*Token
+	ts := NewRefreshTokenSource("id", "secret", &Token{RefreshToken: "refresh-0"}, func(token *Token) error {
+		persisted = append(persisted, token)
+		return nil
+	})
+	ts.TokenURL = server.URL
+	ts.now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		invalidate string
+		expected   string
+		refreshes  int
+	}{
+		{"initial", 0, "", "access-1", 1},
+		{"valid", time.Hour, "", "access-1", 1},
+		{"expiring", 5*time.Hour + 30*time.Second, "", "access-2", 2},
+		{"stale invalidate", 0, "access-1", "access-2", 2},
+		{"rejected", 0, "access-2", "access-3", 3},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		if tt.invalidate != "" {
+			ts.Invalidate(tt.invalidate)
+		}
+		token, err := ts.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != tt.expected || server.refreshes != tt.refreshes || len(persisted) != tt.refreshes {
+			t.Errorf("Token() %s: got: (%s, %d, %d), want: (%s, %d, %d)",
+				tt.name, token.AccessToken, server.refreshes, len(persisted), tt.expected, tt.refreshes, tt.refreshes)
+		}
+	}
+	if last := persisted[len(persisted)-1]; last.RefreshToken != "refresh-3" || !last.ExpiresAt.Equal(now.Add(6*time.Hour)) {
+		t.Errorf("OnRefresh: got: %+v, want: refresh-3 expiring at %s", last, now.Add(6*time.Hour))
+	}
+}
+
+func TestRefreshTokenSourceErrors(t *testing.T) {
+	now := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	server := newTokenServer(func() time.Time { return now })
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		secret     string
+		token      *Token
+		expected   error
+		statusCode int
+	}{
+		{"bad secret", "wrong", &Token{RefreshToken: "refresh-0"}, ErrAuthenticationFailed, http.StatusUnauthorized},
+		{"bad refresh token", "secret", &Token{RefreshToken: "revoked"}, ErrAuthenticationFailed, http.StatusBadRequest},
+		{"no refresh token", "secret", &Token{AccessToken: "expired", ExpiresAt: now}, ErrAuthenticationFailed, 0},
+	}
+	for _, tt := range tests {
+		ts := NewRefreshTokenSource("id", tt.secret, tt.token, nil)
+		ts.TokenURL = server.URL
+		token, err := ts.Token(context.Background())
+		if err == nil || (tt.expected != nil && !errors.Is(err, tt.expected)) {
+			t.Errorf("Token() %s: got: (%v, %v), want: error %v", tt.name, token, err, tt.expected)
+		}
+		// The error reports the status the token endpoint actually responded with.
+		var tokenErr *TokenError
+		if tt.statusCode != 0 && (!errors.As(err, &tokenErr) || tokenErr.StatusCode != tt.statusCode) {
+			t.Errorf("Token() %s: got: %#v, want: *TokenError with status %d", tt.name, err, tt.statusCode)
+		}
+		// A failed refresh leaves the current token in place.
+		if ts.token != tt.token {
+			t.Errorf("Token() %s: got: %+v, want: %+v", tt.name, ts.token, tt.token)
+		}
+	}
+}
+
+func TestRefreshTokenSourcePersistFailed(t *testing.T) {
+	now := time.Date(2018, 6, 12, 12, 0, 0, 0, time.UTC)
+	server := newTokenServer(func() time.Time { return now })
+	defer server.Close()
+
+	persistErr := errors.New("disk full")
+	ts := NewRefreshTokenSource("id", "secret", &Token{RefreshToken: "refresh-0"}, func(*Token) error {
+		return persistErr
+	})
+	ts.TokenURL = server.URL
+	ts.now = func() time.Time { return now }
+	if token, err := ts.Token(context.Background()); err != persistErr {
+		t.Errorf("Token(): got: (%v, %v), want: error %v", token, err, persistErr)
+	}
+	// The refreshed token is kept even though it couldn't be persisted, as the
+	// refresh token it replaced has been rotated.
+	token, err := ts.Token(context.Background())
+	if err != nil || token.AccessToken != "access-1" || server.refreshes != 1 {
+		t.Errorf("Token(): got: (%+v, %v, %d), want: (%s, %v, %d)", token, err, server.refreshes, "access-1", nil, 1)
+	}
+}